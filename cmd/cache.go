@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/jedwards1230/go-kerbal/internal/cache"
+	"github.com/jedwards1230/go-kerbal/internal/registry"
+)
+
+const cacheUsage = `usage: go-kerbal cache <command>
+
+commands:
+  list          show cached archives, most recently used first
+  purge         delete every cached archive
+  fill [ids]    download mods into the cache, or every installed mod if none given`
+
+// Manage the download cache from the command line
+//
+// Returns the exit code.
+func runCache(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(cacheUsage)
+		return 2
+	}
+
+	reg := registry.New()
+	defer reg.DB.Close()
+
+	switch args[0] {
+	case "list":
+		entries, err := reg.Cache.List()
+		if err != nil {
+			fmt.Printf("Error reading cache: %v\n", err)
+			return 1
+		}
+
+		var total int64
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, e := range entries {
+			fmt.Fprintf(w, "%v\t%v\t%v\n", e.Name, cache.FormatSize(e.Size), e.ModTime.Format("2006-01-02 15:04"))
+			total += e.Size
+		}
+		w.Flush()
+		fmt.Printf("%d archives, %v of %v in %v\n", len(entries), cache.FormatSize(total), cache.FormatSize(reg.Cache.MaxSize), reg.Cache.Dir)
+	case "purge":
+		if err := reg.Cache.Purge(); err != nil {
+			fmt.Printf("Error purging cache: %v\n", err)
+			return 1
+		}
+		fmt.Println("Cache purged")
+	case "fill":
+		// ctrl+c stops the downloads, keeping partial files to resume
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		mods, err := reg.PrefillCache(ctx, args[1:])
+		if err != nil {
+			fmt.Printf("Error filling cache: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Cached %d mods\n", len(mods))
+	default:
+		fmt.Println(cacheUsage)
+		return 2
+	}
+
+	log.Printf("Ran cache %v", args[0])
+	return 0
+}
@@ -1,14 +1,18 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/jedwards1230/go-kerbal/internal"
 	"github.com/jedwards1230/go-kerbal/internal/config"
+	"github.com/jedwards1230/go-kerbal/internal/database"
 	"github.com/jedwards1230/go-kerbal/internal/dirfs"
+	"github.com/jedwards1230/go-kerbal/internal/registry"
 	"github.com/jedwards1230/go-kerbal/tui"
 	"github.com/spf13/viper"
 )
@@ -72,6 +76,13 @@ func Execute() {
 		log.Printf("Kerbal Version: %v", cfg.Settings.KerbalVer)
 	}
 
+	recoverJournal()
+	recoverStaging()
+
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		os.Exit(runCache(os.Args[2:]))
+	}
+
 	m := tui.InitialModel()
 
 	var opts []tea.ProgramOption
@@ -89,3 +100,72 @@ func Execute() {
 		os.Exit(1)
 	}
 }
+
+// Offer to finish or undo an apply interrupted by a crash
+func recoverJournal() {
+	kerbalDir := config.GetConfig().Settings.KerbalDir
+	if kerbalDir == "" {
+		return
+	}
+	journal, err := registry.ReadJournal(kerbalDir)
+	if err != nil {
+		log.Printf("Error reading journal: %v", err)
+		fmt.Printf("Could not read the install journal: %v\n", err)
+		return
+	}
+	if journal == nil {
+		return
+	}
+
+	log.Printf("Found unfinished journal: %v", journal)
+	fmt.Println("The last apply was interrupted:")
+	fmt.Printf("  %v\n\n", journal)
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("Roll [f]orward to finish it or [b]ack to undo it? ")
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			log.Printf("No answer for journal, leaving it in place: %v", err)
+			return
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "f", "forward":
+			db := database.GetDB(internal.DBPath)
+			err = journal.RollForward(db)
+			db.Close()
+		case "b", "back":
+			err = journal.RollBack()
+		default:
+			continue
+		}
+
+		if err != nil {
+			log.Printf("Error recovering journal: %v", err)
+			fmt.Printf("Recovery failed: %v\n", err)
+			os.Exit(1)
+		}
+		log.Printf("Recovered interrupted apply")
+		return
+	}
+}
+
+// Clean up after an apply killed before it wrote a journal
+//
+// Nothing in the game folder changed, only its staged files are left.
+func recoverStaging() {
+	kerbalDir := config.GetConfig().Settings.KerbalDir
+	if kerbalDir == "" {
+		return
+	}
+	removed, err := registry.RemoveStaleStaging(kerbalDir)
+	if err != nil {
+		log.Printf("Error removing stale staging folders: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Removed %d staging folders left by an interrupted apply", removed)
+		fmt.Printf("The last apply was interrupted before changing any files. Removed %d leftover staging folders.\n", removed)
+	}
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cache keeps downloaded mod archives between runs
+//
+// Archives are stored by a key derived from their download URL and hash.
+// Reading an archive marks it as recently used; once the cache grows past
+// MaxSize the least recently used archives are deleted first.
+type Cache struct {
+	Dir     string
+	MaxSize int64
+}
+
+// Folder inside the cache holding archives that failed verification
+const quarantineDir = "quarantine"
+
+// Names the cache writes itself, anything else in Dir is left alone
+var (
+	archiveName = regexp.MustCompile(`^([0-9a-f]{16})-([A-Za-z0-9._-]+)\.zip$`)
+	partName    = regexp.MustCompile(`^\.[0-9a-f]{16}-[A-Za-z0-9._-]+\.part$`)
+)
+
+// Archive stored in the cache
+type Entry struct {
+	Key     string
+	Name    string
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Open a cache in dir, creating it if needed
+//
+// An empty dir uses the user cache directory. A maxSize of 0 or less turns
+// off eviction.
+func New(dir string, maxSize int64) (*Cache, error) {
+	if dir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("finding user cache dir: %v", err)
+		}
+		dir = filepath.Join(userCache, "go-kerbal")
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating cache dir: %v", err)
+	}
+	return &Cache{Dir: dir, MaxSize: maxSize}, nil
+}
+
+// Cache key for a download
+func Key(url, hash string) string {
+	sum := sha1.Sum([]byte(url + "\n" + strings.ToLower(hash)))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Find a cached archive, marking it as recently used
+func (c *Cache) Get(key string) (string, bool) {
+	matches, err := filepath.Glob(filepath.Join(c.Dir, key+"-*.zip"))
+	if err != nil {
+		return "", false
+	}
+	matches = filterNames(matches, archiveName)
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(matches[0], now, now); err != nil {
+		log.Printf("Error touching cache entry: %v", err)
+	}
+	return matches[0], true
+}
+
+// Path an archive would be stored at
+//
+// name is a readable label such as the mod identifier and version.
+func (c *Cache) Path(key, name string) string {
+	return filepath.Join(c.Dir, key+"-"+sanitize(name)+".zip")
+}
+
+// Path of an unfinished download of an archive
+//
+// Partial files are hidden from List so they never count as cached.
+func (c *Cache) PartPath(key, name string) string {
+	return filepath.Join(c.Dir, "."+key+"-"+sanitize(name)+".part")
+}
+
+// Move a finished download into the cache
+func (c *Cache) Commit(key, name, part string) (string, error) {
+	dest := c.Path(key, name)
+	if err := os.Rename(part, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// Move an archive out of the cache so it is never used again
+//
+// Returns the new location, kept for inspection until the next purge.
+func (c *Cache) Quarantine(path string) (string, error) {
+	dir := filepath.Join(c.Dir, quarantineDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+filepath.Base(path))
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// List every cached archive, most recently used first
+func (c *Cache) List() ([]Entry, error) {
+	files, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(files))
+	for _, f := range files {
+		name := f.Name()
+		parts := archiveName.FindStringSubmatch(name)
+		if f.IsDir() || parts == nil {
+			continue
+		}
+		entries = append(entries, Entry{
+			Key:     parts[1],
+			Name:    parts[2],
+			Path:    filepath.Join(c.Dir, name),
+			Size:    f.Size(),
+			ModTime: f.ModTime(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime.After(entries[j].ModTime)
+	})
+	return entries, nil
+}
+
+// Total size of every cached archive
+func (c *Cache) Size() (int64, error) {
+	entries, err := c.List()
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+	return size, nil
+}
+
+// Delete every cached archive
+func (c *Cache) Purge() error {
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.Remove(e.Path); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(c.Dir, quarantineDir)); err != nil {
+		return err
+	}
+	parts, _ := filepath.Glob(filepath.Join(c.Dir, ".*.part"))
+	for _, part := range filterNames(parts, partName) {
+		if err := os.Remove(part); err != nil {
+			return err
+		}
+	}
+	log.Printf("Purged %d archives from cache", len(entries))
+	return nil
+}
+
+// Delete least recently used archives until the cache fits MaxSize
+//
+// Archives with a key in keep are never deleted.
+func (c *Cache) Evict(keep map[string]bool) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+
+	for i := len(entries) - 1; i >= 0 && size > c.MaxSize; i-- {
+		if keep[entries[i].Key] {
+			continue
+		}
+		if err := os.Remove(entries[i].Path); err != nil {
+			return err
+		}
+		size -= entries[i].Size
+		log.Printf("Evicted %v from cache", entries[i].Name)
+	}
+	return nil
+}
+
+// Keep the paths whose file name matches re
+func filterNames(paths []string, re *regexp.Regexp) []string {
+	kept := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if re.MatchString(filepath.Base(p)) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// Readable byte count, such as 1.5 MiB
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Keep a label safe to use in a file name
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Write an archive the way a finished download lands in the cache
+func storeTest(t *testing.T, c *Cache, key, name, data string) string {
+	part := c.PartPath(key, name)
+	if err := os.WriteFile(part, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := c.Commit(key, name, part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommitAndGet(t *testing.T) {
+	c, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := Key("https://example.com/Foo.zip", "ABCDEF")
+	if key != Key("https://example.com/Foo.zip", "abcdef") {
+		t.Error("key should ignore hash case")
+	}
+	if _, ok := c.Get(key); ok {
+		t.Fatal("empty cache returned an archive")
+	}
+
+	path := storeTest(t, c, key, "Foo-1.0 beta/2", "zip")
+	got, ok := c.Get(key)
+	if !ok || got != path {
+		t.Fatalf("got %v, %v, want %v", got, ok, path)
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "Foo-1.0_beta_2" || entries[0].Size != 3 {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	c, err := New(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make(map[string]string)
+	old := time.Now().Add(-time.Hour)
+	for i, name := range []string{"a", "b", "c"} {
+		keys[name] = Key("https://example.com/"+name+".zip", "")
+		path := storeTest(t, c, keys[name], name, "12345")
+		when := old.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, when, when); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a is oldest but kept, so b goes first
+	if err := c.Evict(map[string]bool{keys["a"]: true}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.Get(keys[name]); ok != want {
+			t.Errorf("%v cached = %v, want %v", name, ok, want)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	c, err := New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeTest(t, c, Key("https://example.com/a.zip", ""), "a", "1")
+
+	// files the cache did not write are never touched
+	others := []string{"my-notes.txt", "abc-def.zip", ".notes.part"}
+	for _, name := range others {
+		if err := os.WriteFile(filepath.Join(c.Dir, name), []byte("keep"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := c.Size(); err != nil || size != 0 {
+		t.Errorf("size after purge = %v, %v", size, err)
+	}
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(c.Dir, name)); err != nil {
+			t.Errorf("purge removed %v", name)
+		}
+	}
+}
@@ -1,10 +1,8 @@
 package ckan
 
 import (
-	"log"
-
-	"github.com/hashicorp/go-version"
-	"github.com/jedwards1230/go-kerbal/internal/config"
+	"fmt"
+	"strings"
 )
 
 // CKAN Spec: https://github.com/KSP-CKAN/CKAN/blob/master/Spec.md
@@ -18,9 +16,11 @@ type Ckan struct {
 	License        string
 	Valid          bool
 	SearchTags     map[string]interface{}
-	ModConflicts   []string
-	ModDepends     []string
-	IsCompatible   bool
+	ModConflicts   []Relationship
+	ModDepends     []Relationship
+	Provides       []string
+	SourceRepo     string
+	IsCompatible   bool `json:"-"`
 	Versions       versions
 	Install        install
 	Download       download
@@ -111,6 +111,12 @@ func New(raw map[string]interface{}) Ckan {
 		validMod = false
 	}
 
+	valid, err = mod.checkValid(mod.cleanProvides(raw))
+	if !valid {
+		mod.Errors["cleanProvides"] = err
+		validMod = false
+	}
+
 	valid, err = mod.checkValid(mod.cleanSearchSpace(raw))
 	if !valid {
 		mod.Errors["cleanSearchSpace"] = err
@@ -134,36 +140,66 @@ func (c *Ckan) checkValid(err error) (bool, error) {
 	return true, nil
 }
 
-// Compares installed KSP version to min/max compatible for the mod.
-//
-// Returns true if compatible
-func (c Ckan) checkCompatible() bool {
-	cfg := config.GetConfig()
-	configVer := cfg.Settings.KerbalVer
-	kerbalVer, err := version.NewVersion(configVer)
-	if err != nil {
-		log.Printf("Error with kerbal version: %v", err)
+// Returns true if the mod supports any of the given KSP versions
+func (c Ckan) CompatibleWith(versions ...GameVersion) bool {
+	for _, v := range versions {
+		if c.Versions.Ksp.Contains(v) {
+			return true
+		}
 	}
+	return false
+}
 
-	if c.Versions.KspMin != "" {
-		min, err := version.NewVersion(c.Versions.KspMin)
-		if err != nil {
-			log.Printf("Error with kerbal min version: %v", err)
-		}
-		if min.GreaterThan(kerbalVer) {
-			return false
-		}
+// Returns true if the mod is the identifier or provides it as a virtual package
+func (c Ckan) ProvidesIdentifier(identifier string) bool {
+	if c.Identifier == identifier {
+		return true
 	}
-	if c.Versions.KspMax != "" {
-		max, err := version.NewVersion(c.Versions.KspMax)
-		if err != nil {
-			log.Printf("Error with kerbal max version: %v", err)
+	for _, p := range c.Provides {
+		if p == identifier {
+			return true
 		}
-		if max.LessThan(kerbalVer) {
-			return false
+	}
+	return false
+}
+
+// Unique install_to targets of every install stanza
+func (c Ckan) InstallDirs() []string {
+	dirs := make([]string, 0, len(c.Install.Stanzas))
+	seen := make(map[string]bool)
+	for _, stanza := range c.Install.Stanzas {
+		if !seen[stanza.InstallTo] {
+			seen[stanza.InstallTo] = true
+			dirs = append(dirs, stanza.InstallTo)
 		}
 	}
-	return true
+	return dirs
+}
+
+// Strongest hash the metadata gives for the archive, empty if none
+func (d download) Hash() string {
+	if d.Sha256 != "" {
+		return d.Sha256
+	}
+	return d.Sha1
+}
+
+// Internet Archive copy of the download, empty if there can't be one
+//
+// CKAN mirrors redistributable mods under a name built from the
+// identifier, version and sha1.
+func (c Ckan) MirrorURL() string {
+	switch c.License {
+	case "", "restricted", "unknown":
+		return ""
+	}
+	if len(c.Download.Sha1) < 8 || c.Versions.Mod.String() == "" {
+		return ""
+	}
+
+	version := strings.NewReplacer(" ", "_", ":", "-").Replace(c.Versions.Mod.String())
+	name := c.Identifier + "-" + version
+	return fmt.Sprintf("https://archive.org/download/%s/%s-%s.zip", name, strings.ToUpper(c.Download.Sha1[:8]), name)
 }
 
 func (c *Ckan) MarkDownloaded() {
@@ -0,0 +1,32 @@
+package ckan
+
+import "testing"
+
+func TestMirrorURL(t *testing.T) {
+	version, err := ParseVersion("1:1.2 beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mod Ckan
+	mod.Identifier = "Foo"
+	mod.License = "MIT"
+	mod.Versions.Mod = version
+	mod.Download.Sha1 = "a2e2b8c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7"
+
+	want := "https://archive.org/download/Foo-1-1.2_beta/A2E2B8C1-Foo-1-1.2_beta.zip"
+	if got := mod.MirrorURL(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	mod.License = "restricted"
+	if got := mod.MirrorURL(); got != "" {
+		t.Errorf("restricted mod mirrored at %v", got)
+	}
+
+	mod.License = "MIT"
+	mod.Download.Sha1 = ""
+	if got := mod.MirrorURL(); got != "" {
+		t.Errorf("mod without sha1 mirrored at %v", got)
+	}
+}
@@ -3,11 +3,7 @@ package ckan
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
-
-	"github.com/hashicorp/go-version"
-	"github.com/jedwards1230/go-kerbal/internal/config"
 )
 
 func (c *Ckan) cleanSearchSpace(raw map[string]interface{}) error {
@@ -40,85 +36,202 @@ func (c *Ckan) cleanIdentifiers(raw map[string]interface{}) error {
 	return nil
 }
 
+// Parse every install stanza
+//
+// Mods without an install section get the spec default of installing the
+// folder named after the identifier into GameData.
 func (c *Ckan) cleanInstall(raw map[string]interface{}) error {
-	if raw["install"] != nil {
-		var installInfo install
-		rawI := raw["install"].([]interface{})
-		if len(rawI) > 0 {
-			rawInstall := rawI[0].(map[string]interface{})
-			pathFound := false
-
-			switch {
-			case rawInstall["find"] != nil:
-				installInfo.Find = rawInstall["find"].(string)
-				pathFound = true
-			case rawInstall["file"] != nil:
-				installInfo.File = rawInstall["file"].(string)
-				pathFound = true
-			case rawInstall["find_regexp"] != nil:
-				find := rawInstall["find_regexp"].(string)
-				if find == "." {
-					find = ""
-				}
-				installInfo.FindRegex = find
-				pathFound = true
-			}
+	if raw["install"] == nil {
+		c.Install.Stanzas = []InstallStanza{{Find: c.Identifier, InstallTo: "GameData"}}
+		return nil
+	}
 
-			if rawInstall["install_to"] != nil {
-				installInfo.InstallTo = rawInstall["install_to"].(string)
-			}
+	rawList, ok := raw["install"].([]interface{})
+	if !ok {
+		return fmt.Errorf("type mismatch: %T", raw["install"])
+	}
+	if len(rawList) == 0 {
+		return errors.New("empty install path")
+	}
+
+	stanzas := make([]InstallStanza, 0, len(rawList))
+	for _, rawEntry := range rawList {
+		entry, ok := rawEntry.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("type mismatch: %T", rawEntry)
+		}
 
-			if pathFound && installInfo.InstallTo != "" {
-				c.Install = installInfo
-				return nil
+		stanza, err := parseInstallStanza(entry)
+		if err != nil {
+			return err
+		}
+		stanzas = append(stanzas, stanza)
+	}
+	c.Install.Stanzas = stanzas
+	return nil
+}
+
+func parseInstallStanza(entry map[string]interface{}) (InstallStanza, error) {
+	var stanza InstallStanza
+
+	stanza.Find, _ = entry["find"].(string)
+	stanza.FindRegex, _ = entry["find_regexp"].(string)
+	stanza.File, _ = entry["file"].(string)
+	stanza.FindMatchesFiles, _ = entry["find_matches_files"].(bool)
+	stanza.InstallTo, _ = entry["install_to"].(string)
+	stanza.As, _ = entry["as"].(string)
+
+	located := 0
+	for _, s := range []string{stanza.Find, stanza.FindRegex, stanza.File} {
+		if s != "" {
+			located++
+		}
+	}
+	if located != 1 {
+		return stanza, errors.New("install stanza needs exactly one of find, find_regexp or file")
+	}
+	if stanza.InstallTo == "" {
+		return stanza, errors.New("empty install path")
+	}
+	if strings.ContainsAny(stanza.As, "/\\") {
+		return stanza, fmt.Errorf("invalid install name: %v", stanza.As)
+	}
+
+	var err error
+	if stanza.Filter, err = stringList(entry["filter"]); err != nil {
+		return stanza, fmt.Errorf("invalid filter: %v", err)
+	}
+	if stanza.FilterRegex, err = stringList(entry["filter_regexp"]); err != nil {
+		return stanza, fmt.Errorf("invalid filter_regexp: %v", err)
+	}
+	if stanza.IncludeOnly, err = stringList(entry["include_only"]); err != nil {
+		return stanza, fmt.Errorf("invalid include_only: %v", err)
+	}
+	if stanza.IncludeOnlyRegex, err = stringList(entry["include_only_regexp"]); err != nil {
+		return stanza, fmt.Errorf("invalid include_only_regexp: %v", err)
+	}
+	return stanza, nil
+}
+
+// Read a field that may be a single string or a list of them
+func stringList(rawField interface{}) ([]string, error) {
+	switch field := rawField.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{field}, nil
+	case []interface{}:
+		list := make([]string, 0, len(field))
+		for _, v := range field {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("type mismatch: %T", v)
 			}
+			list = append(list, s)
 		}
-		return errors.New("empty install path")
+		return list, nil
 	}
-	return errors.New("no install path")
+	return nil, fmt.Errorf("type mismatch: %T", rawField)
 }
 
 func (c *Ckan) cleanDependencies(raw map[string]interface{}) error {
 	if raw["depends"] != nil {
-		dependsInfo := make([]string, 0)
-		rawI := raw["depends"].([]interface{})
-		if len(rawI) > 0 {
-			rawDepends := rawI[0].(map[string]interface{})
-			if rawDepends["name"] != nil {
-				dependsInfo = append(dependsInfo, rawDepends["name"].(string))
-
-				if len(dependsInfo) > 0 {
-					c.ModDepends = dependsInfo
-					return nil
-				}
-				return fmt.Errorf("error proccessing install dependencies: %v", raw["depends"])
-			}
+		depends, err := parseRelationships(raw["depends"])
+		if err != nil {
+			return fmt.Errorf("error proccessing install dependencies: %v", err)
 		}
+		c.ModDepends = depends
 	}
 	return nil
 }
 
 func (c *Ckan) cleanConflicts(raw map[string]interface{}) error {
 	if raw["conflicts"] != nil {
-		//log.Printf("Conflicts: %v | %T", raw["conflicts"], raw["conflicts"])
-		conflictsInfo := make([]string, 0)
-		rawI := raw["conflicts"].([]interface{})
-		if len(rawI) > 0 {
-			rawConflicts := rawI[0].(map[string]interface{})
-			if rawConflicts["name"] != nil {
-				conflictsInfo = append(conflictsInfo, rawConflicts["name"].(string))
-
-				if len(conflictsInfo) > 0 {
-					c.ModConflicts = conflictsInfo
-					return nil
-				}
-				return fmt.Errorf("error proccessing install conflictions: %v", raw["depends"])
+		conflicts, err := parseRelationships(raw["conflicts"])
+		if err != nil {
+			return fmt.Errorf("error proccessing install conflictions: %v", err)
+		}
+		c.ModConflicts = conflicts
+	}
+	return nil
+}
+
+func (c *Ckan) cleanProvides(raw map[string]interface{}) error {
+	if raw["provides"] != nil {
+		rawList, ok := raw["provides"].([]interface{})
+		if !ok {
+			return fmt.Errorf("type mismatch: %T", raw["provides"])
+		}
+		for _, v := range rawList {
+			identifier, ok := v.(string)
+			if !ok || strings.TrimSpace(identifier) == "" {
+				return fmt.Errorf("invalid provides entry: %v", v)
 			}
+			c.Provides = append(c.Provides, strings.TrimSpace(identifier))
 		}
 	}
 	return nil
 }
 
+// Parse every relationship descriptor in a depends/conflicts list
+func parseRelationships(rawField interface{}) ([]Relationship, error) {
+	rawList, ok := rawField.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("type mismatch: %T", rawField)
+	}
+
+	relationships := make([]Relationship, 0, len(rawList))
+	for _, rawEntry := range rawList {
+		entry, ok := rawEntry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("type mismatch: %T", rawEntry)
+		}
+
+		rel, err := parseRelationship(entry)
+		if err != nil {
+			return nil, err
+		}
+		relationships = append(relationships, rel)
+	}
+	return relationships, nil
+}
+
+func parseRelationship(entry map[string]interface{}) (Relationship, error) {
+	var rel Relationship
+
+	if entry["any_of"] != nil {
+		alternatives, err := parseRelationships(entry["any_of"])
+		if err != nil {
+			return rel, fmt.Errorf("invalid any_of: %v", err)
+		}
+		if len(alternatives) == 0 {
+			return rel, errors.New("empty any_of")
+		}
+		rel.AnyOf = alternatives
+		if help, ok := entry["choice_help_text"].(string); ok {
+			rel.ChoiceHelp = strings.TrimSpace(help)
+		}
+		return rel, nil
+	}
+
+	name, ok := entry["name"].(string)
+	if !ok || strings.TrimSpace(name) == "" {
+		return rel, fmt.Errorf("invalid relationship name: %v", entry["name"])
+	}
+	rel.Name = strings.TrimSpace(name)
+
+	if v, ok := entry["version"].(string); ok {
+		rel.Version = strings.TrimSpace(v)
+	}
+	if v, ok := entry["min_version"].(string); ok {
+		rel.MinVersion = strings.TrimSpace(v)
+	}
+	if v, ok := entry["max_version"].(string); ok {
+		rel.MaxVersion = strings.TrimSpace(v)
+	}
+	return rel, nil
+}
+
 // Clean author name data.
 func (c *Ckan) cleanAuthors(raw map[string]interface{}) error {
 	switch author := raw["author"].(type) {
@@ -142,70 +255,29 @@ func (c *Ckan) cleanAuthors(raw map[string]interface{}) error {
 }
 
 func (c *Ckan) cleanVersions(raw map[string]interface{}) error {
-	var vMod, vMin, vMax *version.Version
-	var epoch string
-	var err error
-	if raw["version"] != nil && strings.TrimSpace(raw["version"].(string)) != "" {
-		v := raw["version"]
-		vMod, epoch, err = c.cleanModVersion(v.(string))
-		if err != nil {
-			return fmt.Errorf("error: %v, v: %v", err, raw["version"].(string))
-		}
-		c.Versions.Epoch = epoch
-
-		if raw["ksp_version_max"] != nil && strings.TrimSpace(raw["ksp_version_max"].(string)) != "" {
-			v = raw["ksp_version_max"]
-			vMax, _, _ = c.cleanModVersion(v.(string))
-		}
-
-		if raw["ksp_version_min"] != nil && strings.TrimSpace(raw["ksp_version_min"].(string)) != "" {
-			v = raw["ksp_version_min"]
-			vMin, _, _ = c.cleanModVersion(v.(string))
-		}
-
-		if raw["ksp_version"] != nil && strings.TrimSpace(raw["ksp_version"].(string)) != "" {
-			v = raw["ksp_version"]
-			cfg := config.GetConfig()
-
-			if v == "any" {
-				vMax, _ = version.NewVersion(cfg.Settings.KerbalVer)
-				vMin, _ = version.NewVersion("0.0")
-			} else {
-				newVKsp, _, err := c.cleanModVersion(v.(string))
-				if err != nil {
-					return fmt.Errorf("invalid mod version: %v", v.(string))
-				}
-
-				if vMax == nil {
-					vMax = newVKsp
-				}
-				if vMin == nil {
-					vMin = newVKsp
-				}
-			}
-		}
-
-		if vMax == nil && vMin != nil {
-			cfg := config.GetConfig()
-			vMax, _ = version.NewVersion(cfg.Settings.KerbalVer)
-		} else if vMin == nil && vMax != nil {
-			vMin, _ = version.NewVersion("0.0")
-		}
-
-		if vMin == nil || vMax == nil {
-			return fmt.Errorf("error: ksp: %v, min: %v, max: %v", raw["ksp_version"], raw["ksp_version_min"], raw["ksp_version_max"])
-		}
+	rawVersion, _ := raw["version"].(string)
+	if strings.TrimSpace(rawVersion) == "" {
+		return errors.New("no version available")
+	}
 
-		c.Versions.Mod = vMod.String()
-		c.Versions.KspMin = vMin.String()
-		c.Versions.KspMax = vMax.String()
+	vMod, err := ParseVersion(rawVersion)
+	if err != nil {
+		return fmt.Errorf("error: %v, v: %v", err, rawVersion)
+	}
+	c.Versions.Mod = vMod
 
-		c.IsCompatible = c.checkCompatible()
+	ksp, _ := raw["ksp_version"].(string)
+	kspMin, _ := raw["ksp_version_min"].(string)
+	kspMax, _ := raw["ksp_version_max"].(string)
+	strict, _ := raw["ksp_version_strict"].(bool)
 
-		return nil
-	} else {
-		return errors.New("no version available")
+	kspRange, err := NewGameVersionRange(ksp, kspMin, kspMax, strict)
+	if err != nil {
+		return fmt.Errorf("error: %v, ksp: %v, min: %v, max: %v", err, ksp, kspMin, kspMax)
 	}
+	c.Versions.Ksp = kspRange
+
+	return nil
 }
 
 func (c *Ckan) cleanAbstract(raw map[string]interface{}) error {
@@ -260,47 +332,59 @@ func (c *Ckan) cleanDownload(raw map[string]interface{}) error {
 		return fmt.Errorf("invalid download path: %v", raw["download"])
 	}
 
-	c.Download.Path = "/" + c.Identifier + ".zip"
 	c.Download.Downloaded = false
 
-	return nil
-}
-
-// Clean version string
-//
-// Returns Version, Epoch, and any errors
-func (c *Ckan) cleanModVersion(rawVersion string) (*version.Version, string, error) {
-	var epoch string
-
-	// check if epoch is stored in version string
-	if strings.Contains(rawVersion, ":") {
-		s := strings.Split(rawVersion, ":")
-		epoch = s[0]
-		rawVersion = s[1]
-	}
-
-	// attempt to parse version
-	newVersion, err := version.NewVersion(rawVersion)
-	if err != nil {
-		re := regexp.MustCompile(`\d+(\.\d+)+`)
-		rawVersion = fmt.Sprint(re.FindAllString(rawVersion, -1))
-
-		if strings.Contains(rawVersion, "[") {
-			rawVersion = strings.ReplaceAll(rawVersion, "[", "")
+	// hashes and size are optional, but must be well formed when given
+	switch hashes := raw["download_hash"].(type) {
+	case nil:
+	case map[string]interface{}:
+		sha1, err := hexField(hashes, "sha1", 40)
+		if err != nil {
+			return err
 		}
-		if strings.Contains(rawVersion, "]") {
-			rawVersion = strings.ReplaceAll(rawVersion, "]", "")
+		sha256, err := hexField(hashes, "sha256", 64)
+		if err != nil {
+			return err
 		}
+		c.Download.Sha1 = sha1
+		c.Download.Sha256 = sha256
+	default:
+		return fmt.Errorf("invalid download_hash: %v", hashes)
+	}
 
-		newVersion, err = version.NewVersion(rawVersion)
-		if err != nil {
-			// TODO: Better version cleaning
-			return newVersion, "", err
+	switch size := raw["download_size"].(type) {
+	case nil:
+	case float64:
+		if size < 0 {
+			return fmt.Errorf("invalid download_size: %v", size)
 		}
-		return newVersion, epoch, nil
+		c.Download.Size = int64(size)
+	default:
+		return fmt.Errorf("invalid download_size: %v", size)
 	}
 
-	return newVersion, epoch, nil
+	return nil
+}
+
+// Read a hex digest of the given length, empty if missing
+func hexField(raw map[string]interface{}, field string, length int) (string, error) {
+	if raw[field] == nil {
+		return "", nil
+	}
+	s, ok := raw[field].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %v hash: %v", field, raw[field])
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) != length {
+		return "", fmt.Errorf("invalid %v hash: %v", field, s)
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return "", fmt.Errorf("invalid %v hash: %v", field, s)
+		}
+	}
+	return s, nil
 }
 
 func clean(dirty string) string {
@@ -0,0 +1,191 @@
+package ckan
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// GameVersion is a KSP version where missing parts act as wildcards
+//
+// "1.12" matches every 1.12.x release and "any" matches everything.
+type GameVersion struct {
+	parts [4]int
+}
+
+// Game version matching every release
+var AnyGameVersion = GameVersion{parts: [4]int{-1, -1, -1, -1}}
+
+// Parse a KSP version such as "1.12", "1.12.3" or "any"
+func ParseGameVersion(raw string) (GameVersion, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.EqualFold(raw, "any") {
+		return AnyGameVersion, nil
+	}
+
+	fields := strings.Split(raw, ".")
+	if len(fields) > 4 {
+		return AnyGameVersion, fmt.Errorf("invalid game version: %v", raw)
+	}
+
+	v := AnyGameVersion
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return AnyGameVersion, fmt.Errorf("invalid game version: %v", raw)
+		}
+		v.parts[i] = n
+	}
+	return v, nil
+}
+
+// Parse a list of KSP versions, skipping any that are invalid
+func ParseGameVersions(raw []string) []GameVersion {
+	versions := make([]GameVersion, 0, len(raw))
+	for _, s := range raw {
+		v, err := ParseGameVersion(s)
+		if err != nil {
+			log.Printf("Skipping game version: %v", err)
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func (v GameVersion) IsAny() bool {
+	return v.parts[0] < 0
+}
+
+// Drop everything after major.minor
+func (v GameVersion) MajorMinor() GameVersion {
+	v.parts[2] = -1
+	v.parts[3] = -1
+	return v
+}
+
+func (v GameVersion) String() string {
+	if v.IsAny() {
+		return "any"
+	}
+	fields := make([]string, 0, len(v.parts))
+	for _, n := range v.parts {
+		if n < 0 {
+			break
+		}
+		fields = append(fields, strconv.Itoa(n))
+	}
+	return strings.Join(fields, ".")
+}
+
+// Returns true if v is at or above the bound, unset bound parts match anything
+func (v GameVersion) AtLeast(bound GameVersion) bool {
+	return v.compareBound(bound) >= 0
+}
+
+// Returns true if v is at or below the bound, unset bound parts match anything
+func (v GameVersion) AtMost(bound GameVersion) bool {
+	return v.compareBound(bound) <= 0
+}
+
+// Compare against a partial bound, stopping at its first unset part
+func (v GameVersion) compareBound(bound GameVersion) int {
+	for i, b := range bound.parts {
+		if b < 0 {
+			return 0
+		}
+		n := v.parts[i]
+		if n < 0 {
+			n = 0
+		}
+		if n != b {
+			if n < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Store game versions as their string form
+func (v GameVersion) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *GameVersion) UnmarshalText(text []byte) error {
+	parsed, err := ParseGameVersion(string(text))
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+// GameVersionRange is the inclusive span of KSP versions a mod supports
+type GameVersionRange struct {
+	Min GameVersion
+	Max GameVersion
+}
+
+// Range matching every release
+var AnyGameVersionRange = GameVersionRange{Min: AnyGameVersion, Max: AnyGameVersion}
+
+// Build a range from the ksp_version fields of a .ckan file
+//
+// ksp_version sets both bounds and is overridden by ksp_version_min and
+// ksp_version_max. Unless strict, bounds only consider major.minor.
+func NewGameVersionRange(ksp, min, max string, strict bool) (GameVersionRange, error) {
+	r := AnyGameVersionRange
+
+	if ksp != "" {
+		v, err := ParseGameVersion(ksp)
+		if err != nil {
+			return r, err
+		}
+		r.Min, r.Max = v, v
+	}
+	if min != "" {
+		v, err := ParseGameVersion(min)
+		if err != nil {
+			return r, err
+		}
+		r.Min = v
+	}
+	if max != "" {
+		v, err := ParseGameVersion(max)
+		if err != nil {
+			return r, err
+		}
+		r.Max = v
+	}
+
+	if !strict {
+		r.Min = r.Min.MajorMinor()
+		r.Max = r.Max.MajorMinor()
+	}
+	return r, nil
+}
+
+// Returns true if the game version falls within the range
+func (r GameVersionRange) Contains(v GameVersion) bool {
+	if v.IsAny() {
+		return true
+	}
+	return (r.Min.IsAny() || v.AtLeast(r.Min)) && (r.Max.IsAny() || v.AtMost(r.Max))
+}
+
+func (r GameVersionRange) String() string {
+	switch {
+	case r.Min.IsAny() && r.Max.IsAny():
+		return "any"
+	case r.Min.IsAny():
+		return "up to " + r.Max.String()
+	case r.Max.IsAny():
+		return r.Min.String() + " and later"
+	case r.Min == r.Max:
+		return r.Min.String()
+	}
+	return r.Min.String() + " - " + r.Max.String()
+}
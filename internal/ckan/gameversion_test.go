@@ -0,0 +1,53 @@
+package ckan
+
+import "testing"
+
+func TestGameVersionRangeContains(t *testing.T) {
+	tests := []struct {
+		ksp, min, max string
+		strict        bool
+		game          string
+		want          bool
+	}{
+		{"1.12", "", "", false, "1.12.3", true},
+		{"1.12", "", "", false, "1.11.2", false},
+		{"1.12.1", "", "", true, "1.12.3", false},
+		{"1.12.1", "", "", false, "1.12.3", true},
+		{"any", "", "", false, "1.2.2", true},
+		{"", "", "", false, "1.12.3", true},
+		{"", "1.8", "", false, "1.12.3", true},
+		{"", "1.8", "", false, "1.7.3", false},
+		{"", "", "1.10", false, "1.10.1", true},
+		{"", "", "1.10", false, "1.11.0", false},
+		{"", "1.10.1", "1.11", true, "1.10.0", false},
+		{"", "1.10.1", "1.11", true, "1.11.9", true},
+	}
+
+	for _, test := range tests {
+		r, err := NewGameVersionRange(test.ksp, test.min, test.max, test.strict)
+		if err != nil {
+			t.Fatalf("could not build range: %v", err)
+		}
+		game, err := ParseGameVersion(test.game)
+		if err != nil {
+			t.Fatalf("could not parse %v: %v", test.game, err)
+		}
+		if got := r.Contains(game); got != test.want {
+			t.Errorf("%v contains %v: got %v, want %v", r, test.game, got, test.want)
+		}
+	}
+}
+
+func TestGameVersionRangeString(t *testing.T) {
+	r, _ := NewGameVersionRange("1.12", "", "", false)
+	if r.String() != "1.12" {
+		t.Errorf("unexpected range: %v", r)
+	}
+	r, _ = NewGameVersionRange("", "1.8", "", false)
+	if r.String() != "1.8 and later" {
+		t.Errorf("unexpected range: %v", r)
+	}
+	if AnyGameVersionRange.String() != "any" {
+		t.Errorf("unexpected range: %v", AnyGameVersionRange)
+	}
+}
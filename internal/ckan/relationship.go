@@ -0,0 +1,118 @@
+package ckan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Relationship describes a single entry in a depends or conflicts field
+//
+// Entries either name a mod directly or list alternatives in AnyOf
+type Relationship struct {
+	Name       string
+	Version    string
+	MinVersion string
+	MaxVersion string
+	AnyOf      []Relationship
+	ChoiceHelp string
+}
+
+// Returns true if the relationship is satisfied by one of several alternatives
+func (r Relationship) IsAnyOf() bool {
+	return len(r.AnyOf) > 0
+}
+
+// Returns true if the identifier is named by the relationship or one of its alternatives
+func (r Relationship) Matches(identifier string) bool {
+	if r.Name == identifier {
+		return true
+	}
+	for _, alt := range r.AnyOf {
+		if alt.Matches(identifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the mod is named by the relationship, directly or through provides
+func (r Relationship) SatisfiedBy(mod Ckan) bool {
+	if r.Matches(mod.Identifier) {
+		return true
+	}
+	for _, p := range mod.Provides {
+		if r.Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the mod version is within the relationship's bounds
+//
+// Unparsable bounds are treated as matching rather than blocking installs
+func (r Relationship) VersionMatches(mod Ckan) bool {
+	check := func(bound string, ok func(int) bool) bool {
+		if bound == "" {
+			return true
+		}
+		v, err := ParseVersion(bound)
+		if err != nil {
+			return true
+		}
+		return ok(mod.Versions.Mod.Compare(v))
+	}
+
+	return check(r.Version, func(cmp int) bool { return cmp == 0 }) &&
+		check(r.MinVersion, func(cmp int) bool { return cmp >= 0 }) &&
+		check(r.MaxVersion, func(cmp int) bool { return cmp <= 0 })
+}
+
+// Returns true if the mod satisfies the relationship within its version bounds
+//
+// Bounds only apply to the mod named. A mod providing the name has version
+// numbers of its own that the bounds say nothing about.
+func (r Relationship) MatchedBy(mod Ckan) bool {
+	if r.IsAnyOf() {
+		for _, alt := range r.AnyOf {
+			if alt.MatchedBy(mod) {
+				return true
+			}
+		}
+		return false
+	}
+	if mod.Identifier == r.Name {
+		return r.VersionMatches(mod)
+	}
+	return r.SatisfiedBy(mod)
+}
+
+// Readable form of the relationship including any version bounds
+func (r Relationship) String() string {
+	switch {
+	case r.IsAnyOf():
+		list := make([]string, 0, len(r.AnyOf))
+		for _, alt := range r.AnyOf {
+			list = append(list, alt.String())
+		}
+		return "any of (" + strings.Join(list, " | ") + ")"
+	case r.Version != "":
+		return fmt.Sprintf("%s (%s)", r.Name, r.Version)
+	case r.MinVersion != "" && r.MaxVersion != "":
+		return fmt.Sprintf("%s (%s - %s)", r.Name, r.MinVersion, r.MaxVersion)
+	case r.MinVersion != "":
+		return fmt.Sprintf("%s (>= %s)", r.Name, r.MinVersion)
+	case r.MaxVersion != "":
+		return fmt.Sprintf("%s (<= %s)", r.Name, r.MaxVersion)
+	}
+	return r.Name
+}
+
+// Join relationships into a comma separated list
+func JoinRelationships(rels []Relationship) string {
+	list := make([]string, 0, len(rels))
+	for _, rel := range rels {
+		list = append(list, rel.String())
+	}
+	return strings.Join(list, ", ")
+}
@@ -0,0 +1,141 @@
+package ckan
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseRelationships(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []Relationship
+		wantErr bool
+	}{
+		{
+			name: "plain",
+			raw:  `[{"name": " Foo "}]`,
+			want: []Relationship{{Name: "Foo"}},
+		},
+		{
+			name: "exact version",
+			raw:  `[{"name": "Foo", "version": "1.2"}]`,
+			want: []Relationship{{Name: "Foo", Version: "1.2"}},
+		},
+		{
+			name: "min and max",
+			raw:  `[{"name": "Foo", "min_version": "1.0", "max_version": "2.0"}]`,
+			want: []Relationship{{Name: "Foo", MinVersion: "1.0", MaxVersion: "2.0"}},
+		},
+		{
+			name: "every entry",
+			raw:  `[{"name": "Foo"}, {"name": "Bar", "min_version": "1.0"}, {"name": "Baz"}]`,
+			want: []Relationship{{Name: "Foo"}, {Name: "Bar", MinVersion: "1.0"}, {Name: "Baz"}},
+		},
+		{
+			name: "any_of",
+			raw:  `[{"any_of": [{"name": "A"}, {"name": "B", "min_version": "1.1"}], "choice_help_text": " pick one "}]`,
+			want: []Relationship{{
+				AnyOf:      []Relationship{{Name: "A"}, {Name: "B", MinVersion: "1.1"}},
+				ChoiceHelp: "pick one",
+			}},
+		},
+		{name: "not a list", raw: `{"name": "Foo"}`, wantErr: true},
+		{name: "entry not an object", raw: `["Foo"]`, wantErr: true},
+		{name: "missing name", raw: `[{"version": "1.0"}]`, wantErr: true},
+		{name: "blank name", raw: `[{"name": "  "}]`, wantErr: true},
+		{name: "empty any_of", raw: `[{"any_of": []}]`, wantErr: true},
+		{name: "bad any_of entry", raw: `[{"any_of": [{"name": 5}]}]`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		var raw interface{}
+		if err := json.Unmarshal([]byte(test.raw), &raw); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		got, err := parseRelationships(raw)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%v: expected error, got %v", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRelationshipVersionMatches(t *testing.T) {
+	tests := []struct {
+		rel     Relationship
+		version string
+		want    bool
+	}{
+		{Relationship{Name: "Foo"}, "0.1", true},
+		{Relationship{Name: "Foo", Version: "1.2"}, "1.2", true},
+		{Relationship{Name: "Foo", Version: "1.2"}, "1.2.1", false},
+		{Relationship{Name: "Foo", MinVersion: "1.0"}, "1.0", true},
+		{Relationship{Name: "Foo", MinVersion: "1.0"}, "0.9", false},
+		{Relationship{Name: "Foo", MaxVersion: "2.0"}, "2.0", true},
+		{Relationship{Name: "Foo", MaxVersion: "2.0"}, "2.1", false},
+		{Relationship{Name: "Foo", MinVersion: "1.0", MaxVersion: "2.0"}, "1.5", true},
+		{Relationship{Name: "Foo", MinVersion: "1.0", MaxVersion: "2.0"}, "2.5", false},
+	}
+
+	for _, test := range tests {
+		var mod Ckan
+		mod.Identifier = "Foo"
+		v, err := ParseVersion(test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mod.Versions.Mod = v
+		if got := test.rel.VersionMatches(mod); got != test.want {
+			t.Errorf("%v with %v: got %v, want %v", test.rel, test.version, got, test.want)
+		}
+	}
+}
+
+func TestRelationshipSatisfiedBy(t *testing.T) {
+	rel := Relationship{AnyOf: []Relationship{{Name: "A"}, {Name: "Virtual"}}}
+
+	var direct, provider, other Ckan
+	direct.Identifier = "A"
+	provider.Identifier = "P"
+	provider.Provides = []string{"Virtual"}
+	other.Identifier = "B"
+
+	if !rel.SatisfiedBy(direct) || !rel.SatisfiedBy(provider) {
+		t.Error("any_of alternative not satisfied")
+	}
+	if rel.SatisfiedBy(other) {
+		t.Error("unrelated mod satisfied any_of")
+	}
+}
+
+func TestRelationshipMatchedBy(t *testing.T) {
+	rel := Relationship{Name: "Foo", MaxVersion: "1.0"}
+
+	var named, provider Ckan
+	named.Identifier = "Foo"
+	named.Versions.Mod, _ = ParseVersion("2.0")
+	provider.Identifier = "P"
+	provider.Provides = []string{"Foo"}
+	provider.Versions.Mod, _ = ParseVersion("2.0")
+
+	if rel.MatchedBy(named) {
+		t.Error("named mod outside the bounds matched")
+	}
+	if !rel.MatchedBy(provider) {
+		t.Error("bounds applied to a providing mod")
+	}
+	if !(Relationship{AnyOf: []Relationship{{Name: "Bar"}, rel}}).MatchedBy(provider) {
+		t.Error("any_of alternative not matched")
+	}
+}
@@ -1,25 +1,39 @@
 package ckan
 
 type versions struct {
-	Epoch  string
-	Mod    string
-	KspMin string
-	KspMax string
-	Spec   string
+	Mod  Version
+	Ksp  GameVersionRange
+	Spec string
 }
 
 type download struct {
 	Downloaded bool
 	URL        string
-	Path       string
+	Sha1       string
+	Sha256     string
+	Size       int64
 }
 
 type install struct {
 	Installed bool
-	FindRegex string
-	Find      string
-	File      string
-	InstallTo string
+	Stanzas   []InstallStanza
+}
+
+// One directive of a mod's install section
+//
+// Exactly one of Find, FindRegex or File locates the files to copy to
+// InstallTo. The remaining fields narrow down or rename what is copied.
+type InstallStanza struct {
+	Find             string
+	FindRegex        string
+	File             string
+	FindMatchesFiles bool
+	InstallTo        string
+	As               string
+	Filter           []string
+	FilterRegex      []string
+	IncludeOnly      []string
+	IncludeOnlyRegex []string
 }
 
 type resource struct {
@@ -0,0 +1,157 @@
+package ckan
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Version is a mod version ordered by the CKAN spec
+//
+// Versions keep the raw string they were parsed from. They compare by epoch
+// first, then by alternating string and number segments of the remainder.
+type Version struct {
+	epoch int
+	body  string
+	raw   string
+}
+
+// Parse a raw version string such as "1:2.0-pre"
+func ParseVersion(raw string) (Version, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Version{}, errors.New("empty version")
+	}
+
+	v := Version{body: raw, raw: raw}
+	if i := strings.Index(raw, ":"); i > 0 {
+		epoch, err := strconv.Atoi(raw[:i])
+		if err == nil && epoch >= 0 {
+			v.epoch = epoch
+			v.body = raw[i+1:]
+		}
+	}
+	return v, nil
+}
+
+// Original version string, epoch included
+func (v Version) String() string {
+	return v.raw
+}
+
+func (v Version) Epoch() int {
+	return v.epoch
+}
+
+func (v Version) IsEmpty() bool {
+	return v.raw == ""
+}
+
+// Compare two versions
+//
+// Returns -1, 0 or 1 if v is older, equal or newer than other
+func (v Version) Compare(other Version) int {
+	if v.epoch != other.epoch {
+		if v.epoch < other.epoch {
+			return -1
+		}
+		return 1
+	}
+
+	a, b := v.body, other.body
+	for a != "" || b != "" {
+		var strA, strB, numA, numB string
+
+		strA, a = splitLeading(a, false)
+		strB, b = splitLeading(b, false)
+		if cmp := compareStringSegment(strA, strB); cmp != 0 {
+			return cmp
+		}
+
+		numA, a = splitLeading(a, true)
+		numB, b = splitLeading(b, true)
+		if cmp := compareNumberSegment(numA, numB); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func (v Version) Equal(other Version) bool {
+	return v.Compare(other) == 0
+}
+
+func (v Version) LessThan(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+func (v Version) GreaterThan(other Version) bool {
+	return v.Compare(other) > 0
+}
+
+// Store versions as their raw string
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.raw), nil
+}
+
+func (v *Version) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*v = Version{}
+		return nil
+	}
+	parsed, err := ParseVersion(string(text))
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+// Split the leading run of digits, or non-digits, from s
+func splitLeading(s string, digits bool) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// Compare string segments the way CKAN does
+//
+// Segments starting with a period sort after anything else, and a lone
+// period sorts after a longer segment that starts with one
+func compareStringSegment(a, b string) int {
+	if a != "" && b != "" {
+		switch {
+		case a[0] != '.' && b[0] == '.':
+			return -1
+		case a[0] == '.' && b[0] != '.':
+			return 1
+		case a[0] == '.' && b[0] == '.':
+			if len(a) == 1 && len(b) > 1 {
+				return 1
+			}
+			if len(a) > 1 && len(b) == 1 {
+				return -1
+			}
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// Compare number segments by value, treating empty as zero
+func compareNumberSegment(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
@@ -0,0 +1,64 @@
+package ckan
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.01", "1.1", 0},
+		{"1:0.1", "2.0", 1},
+		{"2:1.0", "10:0.1", -1},
+		{"v1.2", "v1.10", -1},
+		{"1.0", "1.0-pre", -1},
+		{"1.0-pre", "1.0.1", -1},
+		{"2019.1", "2019.1a", -1},
+		{"1.2.3", "1.2.3", 0},
+		{"0.25.0", "0.25", 1},
+	}
+
+	for _, test := range tests {
+		a, err := ParseVersion(test.a)
+		if err != nil {
+			t.Fatalf("could not parse %v: %v", test.a, err)
+		}
+		b, err := ParseVersion(test.b)
+		if err != nil {
+			t.Fatalf("could not parse %v: %v", test.b, err)
+		}
+		if got := a.Compare(b); got != test.want {
+			t.Errorf("%v compared to %v: got %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := b.Compare(a); got != -test.want {
+			t.Errorf("%v compared to %v: got %d, want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func TestVersionKeepsRaw(t *testing.T) {
+	v, err := ParseVersion("1:2.0-pre")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Epoch() != 1 || v.String() != "1:2.0-pre" {
+		t.Errorf("unexpected parse: epoch %d, raw %v", v.Epoch(), v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Version
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(v) || decoded.String() != v.String() {
+		t.Errorf("round trip changed version: %v -> %v", v, decoded)
+	}
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -11,14 +13,40 @@ import (
 // SettingsConfig struct represents the config for the settings.
 type (
 	SettingsConfig struct {
-		KerbalDir            string `mapstructure:"kerbal_dir"`
-		KerbalVer            string `mapstructure:"kerbal_ver"`
-		MetaRepo             string `mapstructure:"meta_repo"`
-		LastRepoHash         string `mapstructure:"last_repo_hash"`
-		EnableLogging        bool   `mapstructure:"enable_logging"`
-		EnableMouseWheel     bool   `mapstructure:"enable_mousewheel"`
-		HideIncompatibleMods bool   `mapstructure:"hide_incompatible"`
-		Debug                bool   `mapstructure:"debug"`
+		KerbalDir            string             `mapstructure:"kerbal_dir"`
+		KerbalVer            string             `mapstructure:"kerbal_ver"`
+		InstanceVersions     []InstanceVersions `mapstructure:"instance_versions"`
+		MetaRepo             string             `mapstructure:"meta_repo"`
+		MetaRepos            []RepoConfig       `mapstructure:"meta_repos"`
+		LastRepoHash         string             `mapstructure:"last_repo_hash"`
+		MetaPath             string             `mapstructure:"meta_path"`
+		Offline              bool               `mapstructure:"offline"`
+		CacheDir             string             `mapstructure:"cache_dir"`
+		CacheMaxSize         int64              `mapstructure:"cache_max_size"`
+		DownloadRetries      int                `mapstructure:"download_retries"`
+		DownloadBackoff      int                `mapstructure:"download_backoff_ms"`
+		MaxDownloads         int                `mapstructure:"max_downloads"`
+		MaxHostDownloads     int                `mapstructure:"max_host_downloads"`
+		DownloadRateLimit    int64              `mapstructure:"download_rate_limit"`
+		EnableLogging        bool               `mapstructure:"enable_logging"`
+		EnableMouseWheel     bool               `mapstructure:"enable_mousewheel"`
+		HideIncompatibleMods bool               `mapstructure:"hide_incompatible"`
+		Debug                bool               `mapstructure:"debug"`
+	}
+
+	// InstanceVersions are the extra KSP versions accepted for one install
+	InstanceVersions struct {
+		KerbalDir string   `mapstructure:"kerbal_dir"`
+		Versions  []string `mapstructure:"versions"`
+	}
+
+	// RepoConfig is a metadata repository. When two repos provide the same
+	// identifier, the one with the higher priority wins, then the one listed
+	// first.
+	RepoConfig struct {
+		Name     string `mapstructure:"name"`
+		URL      string `mapstructure:"url"`
+		Priority int    `mapstructure:"priority"`
 	}
 
 	Config struct {
@@ -56,8 +84,19 @@ func LoadConfig(dir string) {
 	// Setup config defaults.
 	viper.SetDefault("settings.kerbal_dir", "")
 	viper.SetDefault("settings.kerbal_ver", "")
+	viper.SetDefault("settings.instance_versions", []map[string]interface{}{})
 	viper.SetDefault("settings.meta_repo", "https://github.com/KSP-CKAN/CKAN-meta.git")
+	viper.SetDefault("settings.meta_repos", []map[string]interface{}{})
 	viper.SetDefault("settings.last_repo_hash", "")
+	viper.SetDefault("settings.meta_path", "")
+	viper.SetDefault("settings.offline", false)
+	viper.SetDefault("settings.cache_dir", "")
+	viper.SetDefault("settings.cache_max_size", 5120)
+	viper.SetDefault("settings.download_retries", 3)
+	viper.SetDefault("settings.download_backoff_ms", 1000)
+	viper.SetDefault("settings.max_downloads", 4)
+	viper.SetDefault("settings.max_host_downloads", 2)
+	viper.SetDefault("settings.download_rate_limit", 0)
 	viper.SetDefault("settings.enable_logging", true)
 	viper.SetDefault("settings.enable_mousewheel", true)
 	viper.SetDefault("settings.hide_incompatible", true)
@@ -93,3 +132,69 @@ func GetConfig() (config Config) {
 
 	return
 }
+
+// CompatibleVersions returns the extra KSP versions accepted for KerbalDir.
+func (s SettingsConfig) CompatibleVersions() []string {
+	for _, instance := range s.InstanceVersions {
+		if instance.KerbalDir == s.KerbalDir {
+			return instance.Versions
+		}
+	}
+	return []string{}
+}
+
+// SetCompatibleVersions saves the extra KSP versions accepted for kerbalDir.
+//
+// Other installs keep their own list.
+func SetCompatibleVersions(kerbalDir string, versions []string) {
+	cfg := GetConfig()
+	instances := make([]map[string]interface{}, 0, len(cfg.Settings.InstanceVersions)+1)
+	for _, instance := range cfg.Settings.InstanceVersions {
+		if instance.KerbalDir != kerbalDir {
+			instances = append(instances, map[string]interface{}{"kerbal_dir": instance.KerbalDir, "versions": instance.Versions})
+		}
+	}
+	if len(versions) > 0 {
+		instances = append(instances, map[string]interface{}{"kerbal_dir": kerbalDir, "versions": versions})
+	}
+	viper.Set("settings.instance_versions", instances)
+}
+
+// Repos returns the metadata repos in config order.
+//
+// Falls back to MetaRepo when no list is configured. Names are used in
+// database keys and directory names, so unsafe characters are replaced and
+// duplicate or reserved names are rejected.
+func (s SettingsConfig) Repos() ([]RepoConfig, error) {
+	if len(s.MetaRepos) == 0 {
+		return []RepoConfig{{Name: DefaultRepoName, URL: s.MetaRepo}}, nil
+	}
+
+	repos := make([]RepoConfig, 0, len(s.MetaRepos))
+	seen := make(map[string]bool, len(s.MetaRepos))
+	for i, repo := range s.MetaRepos {
+		repo.Name = repoNameReplacer.Replace(strings.TrimSpace(repo.Name))
+		if repo.Name == "" {
+			repo.Name = fmt.Sprintf("repo%d", i+1)
+		}
+		if repo.Name == "." || repo.Name == ".." || strings.EqualFold(repo.Name, SnapshotRepoName) {
+			return nil, fmt.Errorf("metadata repo name %q is reserved", repo.Name)
+		}
+		// clone folders may live on a case-insensitive filesystem
+		key := strings.ToLower(repo.Name)
+		if seen[key] {
+			return nil, fmt.Errorf("metadata repo name %q is used more than once", repo.Name)
+		}
+		seen[key] = true
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+// DefaultRepoName names the repo given by MetaRepo
+const DefaultRepoName = "CKAN-meta"
+
+// SnapshotRepoName names the mods imported from MetaPath
+const SnapshotRepoName = "snapshot"
+
+var repoNameReplacer = strings.NewReplacer(":", "_", "/", "_", "\\", "_", "*", "_", "?", "_")
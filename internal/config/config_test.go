@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCompatibleVersionsPerInstance(t *testing.T) {
+	defer viper.Reset()
+
+	viper.Set("settings.kerbal_dir", "/games/ksp-a")
+	SetCompatibleVersions("/games/ksp-a", []string{"1.11", "1.10"})
+	viper.Set("settings.kerbal_dir", "/games/ksp-b")
+	if got := GetConfig().Settings.CompatibleVersions(); len(got) != 0 {
+		t.Errorf("new instance inherited versions: %v", got)
+	}
+	SetCompatibleVersions("/games/ksp-b", []string{"1.8"})
+
+	// switching back keeps the first instance's choices
+	viper.Set("settings.kerbal_dir", "/games/ksp-a")
+	if got := GetConfig().Settings.CompatibleVersions(); !reflect.DeepEqual(got, []string{"1.11", "1.10"}) {
+		t.Errorf("got %v for ksp-a", got)
+	}
+
+	SetCompatibleVersions("/games/ksp-a", nil)
+	if got := GetConfig().Settings.CompatibleVersions(); len(got) != 0 {
+		t.Errorf("cleared versions still set: %v", got)
+	}
+	viper.Set("settings.kerbal_dir", "/games/ksp-b")
+	if got := GetConfig().Settings.CompatibleVersions(); !reflect.DeepEqual(got, []string{"1.8"}) {
+		t.Errorf("got %v for ksp-b", got)
+	}
+}
+
+func TestRepos(t *testing.T) {
+	settings := SettingsConfig{MetaRepo: "https://example.com/meta.git"}
+	repos, err := settings.Repos()
+	if err != nil || len(repos) != 1 || repos[0].Name != DefaultRepoName {
+		t.Fatalf("expected fallback to MetaRepo, got %v, %v", repos, err)
+	}
+
+	settings.MetaRepos = []RepoConfig{{Name: "team/tools"}, {Name: ""}}
+	repos, err = settings.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repos[0].Name != "team_tools" || repos[1].Name != "repo2" {
+		t.Errorf("unexpected names: %v", repos)
+	}
+
+	invalid := map[string][]RepoConfig{
+		"duplicate":      {{Name: "team"}, {Name: "team"}},
+		"duplicate case": {{Name: "Team"}, {Name: "team"}},
+		"sanitized":      {{Name: "a:b"}, {Name: "a/b"}},
+		"dot":            {{Name: "."}},
+		"dotdot":         {{Name: ".."}},
+		"snapshot":       {{Name: "Snapshot"}},
+	}
+	for name, list := range invalid {
+		settings.MetaRepos = list
+		if _, err := settings.Repos(); err == nil {
+			t.Errorf("%v: expected names %v to be rejected", name, list)
+		}
+	}
+}
@@ -11,14 +11,16 @@ const (
 )
 
 const (
-	CommandView     = 0
-	ModListView     = 1
-	ModInfoView     = 2
-	LogView         = 3
-	EnterKspDirView = 4
-	SearchView      = 5
-	SettingsView    = 6
-	QueueView       = 7
+	CommandView        = 0
+	ModListView        = 1
+	ModInfoView        = 2
+	LogView            = 3
+	EnterKspDirView    = 4
+	SearchView         = 5
+	SettingsView       = 6
+	QueueView          = 7
+	CompatVersionsView = 8
+	CacheView          = 9
 )
 
 const (
@@ -36,9 +38,12 @@ const (
 )
 
 const (
-	MenuInputs     = 4
-	MenuSortOrder  = 0
-	MenuSortTag    = 1
-	MenuCompatible = 2
-	MenuKspDir     = 3
+	MenuInputs         = 7
+	MenuSortOrder      = 0
+	MenuSortTag        = 1
+	MenuCompatible     = 2
+	MenuKspDir         = 3
+	MenuCompatVersions = 4
+	MenuCache          = 5
+	MenuCacheFill      = 6
 )
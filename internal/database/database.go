@@ -1,117 +1,333 @@
 package database
 
 import (
+	"context"
 	// Using standard json encoder here because benchmarks showed segmentio to be slightly slower
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
-	"strconv"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 
 	"github.com/go-git/go-billy/v5"
-	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
 	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/jedwards1230/go-kerbal/internal/ckan"
 	"github.com/jedwards1230/go-kerbal/internal/common"
 	"github.com/jedwards1230/go-kerbal/internal/config"
-	"github.com/jedwards1230/go-kerbal/internal/dirfs"
 	"github.com/spf13/viper"
 	"github.com/tidwall/buntdb"
 )
 
+// Version of the stored mod layout. Bump whenever ckan.Ckan changes shape so
+// databases written by older builds are rebuilt instead of half-loaded.
+const SchemaVersion = "11"
+
+const schemaKey = "meta:schema"
+
+// Commit of a metadata repo the stored mods were read from
+const repoHashKey = "meta:repo_hash:"
+
 // Wrapper for buntDB
 type CkanDB struct {
 	*buntdb.DB
+
+	// local clones of the metadata repos, kept between runs
+	RepoDir string
 }
 
 // Open database file
 func GetDB(s string) *CkanDB {
 	database, _ := buntdb.Open(s)
-	db := &CkanDB{DB: database}
+	db := &CkanDB{DB: database, RepoDir: filepath.Join(filepath.Dir(s), "meta-repos")}
 	return db
 }
 
-// Update the database by checking the repo and applying any new changes
-func (c *CkanDB) UpdateDB(force_update bool) error {
+// Update the database by checking the repos and applying any new changes
+//
+// Only .ckan files changed since the last update are parsed again, unless
+// force_update is set or the stored mods can't be matched to a commit.
+// Cancelling ctx stops the update and leaves the stored mods untouched.
+func (c *CkanDB) UpdateDB(ctx context.Context, force_update bool) error {
 	log.Printf("Updating DB. Force Update: %v", force_update)
+	cfg := config.GetConfig()
+	if cfg.Settings.MetaPath != "" {
+		return c.importSnapshot(ctx, cfg.Settings.MetaPath, force_update)
+	}
+
+	// Rebuild if the stored layout is outdated
+	if !force_update && !c.schemaCurrent() {
+		log.Printf("Database schema outdated, forcing update")
+		force_update = true
+	}
+
+	repos, err := cfg.Settings.Repos()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(repos))
+	for i, repo := range repos {
+		names[i] = repo.Name
+	}
+	if err := c.pruneRepos(names...); err != nil {
+		return err
+	}
+
+	// an unreachable repo shouldn't hold back the others
+	var firstErr error
+	for i, repo := range repos {
+		hash, err := c.updateRepo(ctx, repo, force_update, cfg.Settings.Offline)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Error updating %v: %v", repo.Name, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%v: %v", repo.Name, err)
+			}
+			continue
+		}
+		if i == 0 {
+			saveRepoHash(hash)
+		}
+	}
+	return firstErr
+}
+
+// Bring the mods of one repo up to date, returning the commit they were read from
+func (c *CkanDB) updateRepo(ctx context.Context, cfgRepo config.RepoConfig, force_update, offline bool) (string, error) {
+	base := c.repoHash(cfgRepo.Name)
+	if !force_update && base == "" {
+		log.Printf("No commit recorded for %v, forcing update", cfgRepo.Name)
+		force_update = true
+	}
+
 	// Check if update is required
-	if !force_update {
-		changes := checkRepoChanges()
+	if !force_update && !offline {
+		changes := checkRepoChanges(ctx, cfgRepo.URL, base)
 		if !changes {
-			log.Printf("No repo changes detected")
-			return nil
+			log.Printf("No repo changes detected for %v", cfgRepo.Name)
+			return base, nil
 		}
 	}
 
-	// Clone repo
-	fs, err := cloneRepo()
+	// Bring the local clone up to date, offline it is used as is
+	dir := filepath.Join(c.RepoDir, cfgRepo.Name)
+	var repo *git.Repository
+	var head *plumbing.Reference
+	var err error
+	if offline {
+		repo, head, err = openRepo(dir)
+	} else {
+		repo, head, err = syncRepo(ctx, dir, cfgRepo.URL)
+	}
 	if err != nil {
-		log.Printf("Error cloning repo: %v", err)
-		return err
+		log.Printf("Error syncing repo: %v", err)
+		return "", err
+	}
+	tree, err := headTree(repo, head)
+	if err != nil {
+		return "", err
 	}
+	parse := treeParser(tree)
+	hash := head.Hash().String()
 
-	// Get currently downloaded .ckan files
-	log.Printf("Searching for .ckan files")
-	var filesToScan []string
-	filesToScan = append(filesToScan, dirfs.FindFilePaths(fs, ".ckan")...)
+	if !force_update {
+		changed, deleted, err := diffCommits(ctx, repo, base, head)
+		if err == nil {
+			log.Printf("Applying %d changed and %d deleted .ckan files from %v", len(changed), len(deleted), cfgRepo.Name)
+			err = c.updateMods(ctx, cfgRepo.Name, false, changed, parse, deleted, hash)
+			return hash, err
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		log.Printf("Could not diff from %v, rebuilding: %v", base, err)
+	}
 
-	err = c.updateDB(&fs, filesToScan)
+	// Get every .ckan file in the repo
+	log.Printf("Searching for .ckan files in %v", cfgRepo.Name)
+	files, err := ckanFiles(tree)
+	if err != nil {
+		return "", err
+	}
 
-	return err
+	err = c.updateMods(ctx, cfgRepo.Name, true, files, parse, nil, hash)
+	return hash, err
 }
 
-func (c *CkanDB) updateDB(fs *billy.Filesystem, filesToScan []string) error {
-	var mods []ckan.Ckan
-
+// Parse files and store the mods under their repo and path
+//
+// A full update replaces every stored mod of the repo. Otherwise only the
+// given files are written and deleted ones removed.
+func (c *CkanDB) updateMods(ctx context.Context, repo string, full bool, files []string, parse func(string) (ckan.Ckan, error), deleted []string, hash string) error {
 	goodCount := 0
 	ignoredCount := 0
 	errCount := 0
 	log.Print("Cleaning mod files")
+
+	queue := make(chan string)
+	go func() {
+		defer close(queue)
+		for _, file := range files {
+			if ctx.Err() != nil {
+				return
+			}
+			queue <- file
+		}
+	}()
+
+	mods := make(map[string]ckan.Ckan, len(files))
+	invalid := make([]string, 0)
 	var wg sync.WaitGroup
 	mu := &sync.Mutex{}
-
-	wg.Add(len(filesToScan))
-	for i := range filesToScan {
-		// Parse .ckan from repo into JSON
-		go func(i int) {
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
 			defer wg.Done()
+			for file := range queue {
+				mod, err := parse(file)
 
-			mod, err := parseCKAN(*fs, filesToScan[i])
-			if err != nil || !mod.Valid {
-				if c.viewParseErrors(mod) {
-					ignoredCount++
+				mu.Lock()
+				if err != nil || !mod.Valid {
+					if c.viewParseErrors(mod) {
+						ignoredCount++
+					} else {
+						errCount++
+					}
+					invalid = append(invalid, file)
 				} else {
-					errCount++
+					mod.SourceRepo = repo
+					mods[file] = mod
+					goodCount++
 				}
-			} else {
-				mu.Lock()
-				mods = append(mods, mod)
 				mu.Unlock()
-				goodCount++
 			}
-		}(i)
+		}()
 	}
 	wg.Wait()
 	log.Printf("Scanned mod files | %d good | %d errors | %d missing info", goodCount, errCount, ignoredCount)
 
+	// a partial scan must not replace the stored mods
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	err := c.Update(func(tx *buntdb.Tx) error {
-		for i := range mods {
-			byteValue, err := json.Marshal(mods[i])
+		if full {
+			// clear previous import
+			var keys []string
+			tx.AscendKeys(modKey(repo, "*"), func(key, _ string) bool {
+				keys = append(keys, key)
+				return true
+			})
+			for _, key := range keys {
+				if _, err := tx.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		// files that are gone or no longer parse drop their mod
+		for _, path := range append(deleted, invalid...) {
+			if _, err := tx.Delete(modKey(repo, path)); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
+
+		for path, mod := range mods {
+			byteValue, err := json.Marshal(mod)
 			if err != nil {
 				log.Printf("Error: %s", err)
 				return err
 			}
-			tx.Set("mod:"+strconv.Itoa(i), string(byteValue), nil)
+			tx.Set(modKey(repo, path), string(byteValue), nil)
 		}
-		log.Printf("Database updated with %d mods", len(mods))
-		return nil
+		log.Printf("Database updated with %d mods from %v", len(mods), repo)
+
+		if _, _, err := tx.Set(repoHashKey+repo, hash, nil); err != nil {
+			return err
+		}
+		_, _, err := tx.Set(schemaKey, SchemaVersion, nil)
+		return err
 	})
 	return err
 }
 
+// Key of the mod read from a .ckan file of repo
+func modKey(repo, path string) string {
+	return "mod:" + repo + ":" + path
+}
+
+// Remove the mods and commits of every repo not in keep
+func (c *CkanDB) pruneRepos(keep ...string) error {
+	kept := make(map[string]bool, len(keep))
+	for _, name := range keep {
+		kept[name] = true
+	}
+
+	return c.Update(func(tx *buntdb.Tx) error {
+		var keys []string
+		tx.AscendKeys("mod:*", func(key, _ string) bool {
+			repo := strings.TrimPrefix(key, "mod:")
+			if i := strings.Index(repo, ":"); i >= 0 {
+				repo = repo[:i]
+			}
+			if !kept[repo] {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		tx.AscendKeys(repoHashKey+"*", func(key, _ string) bool {
+			if !kept[strings.TrimPrefix(key, repoHashKey)] {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if len(keys) > 0 {
+			log.Printf("Removing %d entries of unused repos", len(keys))
+		}
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Commit the stored mods of repo were read from, empty if unknown
+func (c *CkanDB) repoHash(repo string) string {
+	var hash string
+	c.View(func(tx *buntdb.Tx) error {
+		hash, _ = tx.Get(repoHashKey + repo)
+		return nil
+	})
+	return hash
+}
+
+func saveRepoHash(hash string) {
+	viper.Set("settings.last_repo_hash", hash)
+	viper.WriteConfigAs(viper.ConfigFileUsed())
+}
+
+// Check stored mods were written with the current layout
+func (c *CkanDB) schemaCurrent() bool {
+	var current bool
+	c.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(schemaKey)
+		current = err == nil && val == SchemaVersion
+		return nil
+	})
+	return current
+}
+
 // Return true if errors but ignored
 //
 // Errors would be ignored if they don't satisfy the required fields
@@ -154,10 +370,16 @@ func parseCKAN(repo billy.Filesystem, filePath string) (ckan.Ckan, error) {
 	if err != nil {
 		return mod, err
 	}
+	return parseCKANData(byteValue)
+}
+
+// Parse the contents of a .ckan file into a Ckan struct
+func parseCKANData(byteValue []byte) (ckan.Ckan, error) {
+	var mod ckan.Ckan
 
 	// Store .ckan in struct and interface
 	var raw map[string]interface{}
-	err = json.Unmarshal(byteValue, &raw)
+	err := json.Unmarshal(byteValue, &raw)
 	if err != nil {
 		return mod, err
 	}
@@ -172,22 +394,21 @@ func parseCKAN(repo billy.Filesystem, filePath string) (ckan.Ckan, error) {
 	return mod, err
 }
 
-// Checks for changes to the repo by comparing commit hashes
+// Checks for changes to the repo at url by comparing its latest commit with last
 //
 // Returns true if changes were detected
-func checkRepoChanges() bool {
+func checkRepoChanges(ctx context.Context, url, last string) bool {
 	log.Println("Checking repo for changes")
 
 	// Load metadata repo
-	cfg := config.GetConfig()
 	storer := memory.NewStorage()
 	rem := git.NewRemote(storer, &gitConfig.RemoteConfig{
 		Name: "master",
-		URLs: []string{cfg.Settings.MetaRepo},
+		URLs: []string{url},
 	})
 
 	// Gather reference list
-	refs, err := rem.List(&git.ListOptions{})
+	refs, err := rem.ListContext(ctx, &git.ListOptions{})
 	if err != nil {
 		log.Printf("Error loading remote list: %v", err)
 	}
@@ -195,37 +416,13 @@ func checkRepoChanges() bool {
 	// Finds last hash in master
 	for _, ref := range refs {
 		if ref.Name().IsBranch() && ref.Name() == "refs/heads/master" {
-			log.Printf("Loading: %s %v", cfg.Settings.MetaRepo, ref.Name())
+			log.Printf("Loading: %s %v", url, ref.Name())
 			log.Printf("Latest commit: %v", ref.Hash().String())
 			// if hashes match, return false to show no changes
-			if cfg.Settings.LastRepoHash == ref.Hash().String() {
+			if last == ref.Hash().String() {
 				return false
 			}
 		}
 	}
 	return true
 }
-
-func cloneRepo() (billy.Filesystem, error) {
-	cfg := config.GetConfig()
-	log.Println("Cloning database repo")
-	fs := memfs.New()
-	storer := memory.NewStorage()
-	repo, err := git.Clone(storer, fs, &git.CloneOptions{
-		URL:   cfg.Settings.MetaRepo,
-		Depth: 1,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	ref, err := repo.Head()
-	if err != nil {
-		return nil, err
-	}
-
-	viper.Set("settings.last_repo_hash", ref.Hash().String())
-	viper.WriteConfigAs(viper.ConfigFileUsed())
-
-	return fs, nil
-}
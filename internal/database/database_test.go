@@ -1,17 +1,16 @@
 package database
 
 import (
+	"context"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
-	"github.com/go-git/go-billy/v5"
 	"github.com/jedwards1230/go-kerbal/internal/config"
-	"github.com/jedwards1230/go-kerbal/internal/dirfs"
 )
 
 var db *CkanDB
-var fs billy.Filesystem
 var logPath = "../../logs/database_test.log"
 
 func TestMain(m *testing.M) {
@@ -59,10 +58,11 @@ func DeleteTestDB() {
 	if err != nil {
 		log.Print(err)
 	}
+	os.RemoveAll(db.RepoDir)
 }
 
 func TestUpdateDB(t *testing.T) {
-	err := db.UpdateDB(true)
+	err := db.UpdateDB(context.Background(), true)
 	if err != nil {
 		t.Errorf("Error updating database %v", err)
 	}
@@ -70,7 +70,7 @@ func TestUpdateDB(t *testing.T) {
 
 /* func BenchmarkUpdateDB(b *testing.B) {
 	for n := 0; n < b.N; n++ {
-		err := db.UpdateDB(true)
+		err := db.UpdateDB(context.Background(), true)
 		if err != nil {
 			b.Error(err)
 		}
@@ -78,39 +78,45 @@ func TestUpdateDB(t *testing.T) {
 } */
 
 func TestCheckRepoChanges(t *testing.T) {
-	_ = checkRepoChanges()
+	cfg := config.GetConfig()
+	_ = checkRepoChanges(context.Background(), cfg.Settings.MetaRepo, cfg.Settings.LastRepoHash)
 }
 
 func BenchmarkCheckRepoChanges(b *testing.B) {
+	cfg := config.GetConfig()
 	for n := 0; n < b.N; n++ {
-		_ = checkRepoChanges()
+		_ = checkRepoChanges(context.Background(), cfg.Settings.MetaRepo, cfg.Settings.LastRepoHash)
 	}
 }
 
-/* func TestCloneRepo(t *testing.T) {
-	var err error
-	repo, err := cloneRepo()
-	if err != nil {
-		t.Error(err)
-	}
-	fs = repo
-} */
-
-func BenchmarkCloneRepo(b *testing.B) {
-	var err error
+func BenchmarkSyncRepo(b *testing.B) {
+	cfg := config.GetConfig()
+	dir := b.TempDir()
 	for n := 0; n < b.N; n++ {
-		fs, err = cloneRepo()
+		_, _, err := syncRepo(context.Background(), dir, cfg.Settings.MetaRepo)
 		if err != nil {
 			b.Error(err)
 		}
 	}
 }
 
-func BenchmarkUpdateDBDirect(b *testing.B) {
-	var filesToScan []string
-	filesToScan = append(filesToScan, dirfs.FindFilePaths(fs, ".ckan")...)
+func BenchmarkUpdateModsFull(b *testing.B) {
+	cfg := config.GetConfig()
+	repo, head, err := syncRepo(context.Background(), filepath.Join(db.RepoDir, config.DefaultRepoName), cfg.Settings.MetaRepo)
+	if err != nil {
+		b.Fatal(err)
+	}
+	tree, err := headTree(repo, head)
+	if err != nil {
+		b.Fatal(err)
+	}
+	files, err := ckanFiles(tree)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
-		err := db.updateDB(&fs, filesToScan)
+		err := db.updateMods(context.Background(), config.DefaultRepoName, true, files, treeParser(tree), nil, head.Hash().String())
 		if err != nil {
 			b.Error(err)
 		}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+const installedPrefix = "installed:"
+
+// Record of everything a mod wrote into one KSP instance
+//
+// Paths are slash separated and relative to the KSP directory.
+type InstalledMod struct {
+	Identifier  string
+	Version     string
+	KerbalDir   string
+	Files       []InstalledFile
+	Directories []string
+}
+
+type InstalledFile struct {
+	Path string
+	Size int64
+	Sha1 string
+}
+
+// Returns true if the manifest lists the file
+func (m InstalledMod) OwnsFile(path string) bool {
+	for _, f := range m.Files {
+		if strings.EqualFold(f.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the manifest lists dir or anything inside it
+func (m InstalledMod) OwnsUnder(dir string) bool {
+	dir = strings.ToLower(strings.TrimSuffix(dir, "/"))
+	under := func(p string) bool {
+		p = strings.ToLower(p)
+		return p == dir || strings.HasPrefix(p, dir+"/")
+	}
+	for _, f := range m.Files {
+		if under(f.Path) {
+			return true
+		}
+	}
+	for _, d := range m.Directories {
+		if under(d) {
+			return true
+		}
+	}
+	return false
+}
+
+func installedKey(kerbalDir, identifier string) string {
+	return installedPrefix + kerbalDir + ":" + identifier
+}
+
+// Store the manifest of an installed mod, replacing any previous one
+func (c *CkanDB) SaveInstalled(mod InstalledMod) error {
+	byteValue, err := json.Marshal(mod)
+	if err != nil {
+		return err
+	}
+	return c.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(installedKey(mod.KerbalDir, mod.Identifier), string(byteValue), nil)
+		return err
+	})
+}
+
+// Forget the manifest of a removed mod
+func (c *CkanDB) DeleteInstalled(kerbalDir, identifier string) error {
+	return c.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(installedKey(kerbalDir, identifier))
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// Get every manifest recorded for a KSP instance, keyed by identifier
+func (c *CkanDB) GetInstalled(kerbalDir string) (map[string]InstalledMod, error) {
+	prefix := installedPrefix + kerbalDir + ":"
+	installed := make(map[string]InstalledMod)
+	err := c.View(func(tx *buntdb.Tx) error {
+		var err error
+		tx.AscendGreaterOrEqual("", prefix, func(key, value string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+			var mod InstalledMod
+			if err = json.Unmarshal([]byte(value), &mod); err != nil {
+				return false
+			}
+			// the prefix alone also matches instances whose path extends this one
+			if mod.KerbalDir == kerbalDir {
+				installed[mod.Identifier] = mod
+			}
+			return true
+		})
+		return err
+	})
+	return installed, err
+}
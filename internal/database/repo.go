@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+)
+
+const metaBranch = "master"
+
+// Clone the metadata repo into dir, or fetch new commits if it is already there
+//
+// Returns the repo and its latest commit on the metadata branch.
+func syncRepo(ctx context.Context, dir, url string) (*git.Repository, *plumbing.Reference, error) {
+	repo, err := git.PlainOpen(dir)
+	if err == nil && !sameOrigin(repo, url) {
+		log.Printf("Metadata repo changed to %v, cloning again", url)
+		repo = nil
+	}
+
+	if repo == nil || err != nil {
+		repo, err = cloneRepo(ctx, dir, url)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		log.Printf("Fetching %v", url)
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: git.DefaultRemoteName,
+			Depth:      1,
+			Force:      true,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return nil, nil, err
+		}
+	}
+
+	head, err := latestCommit(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, head, nil
+}
+
+// Open the clone in dir without fetching
+func openRepo(dir string) (*git.Repository, *plumbing.Reference, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no local metadata repo in %v: %v", dir, err)
+	}
+	head, err := latestCommit(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, head, nil
+}
+
+// Find the newest fetched commit of the metadata branch
+func latestCommit(repo *git.Repository) (*plumbing.Reference, error) {
+	head, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, metaBranch), true)
+	if err != nil {
+		// a fresh clone may only carry the local branch
+		head, err = repo.Reference(plumbing.NewBranchReferenceName(metaBranch), true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Latest commit: %v", head.Hash())
+	return head, nil
+}
+
+// Replace dir with a shallow bare clone of the metadata branch
+func cloneRepo(ctx context.Context, dir, url string) (*git.Repository, error) {
+	log.Printf("Cloning %v into %v", url, dir)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	repo, err := git.PlainCloneContext(ctx, dir, true, &git.CloneOptions{
+		URL:           url,
+		ReferenceName: plumbing.NewBranchReferenceName(metaBranch),
+		SingleBranch:  true,
+		Depth:         1,
+	})
+	if err != nil {
+		// don't leave a half cloned repo behind for the next run
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Check the clone still points at url
+func sameOrigin(repo *git.Repository, url string) bool {
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return false
+	}
+	urls := remote.Config().URLs
+	return len(urls) > 0 && urls[0] == url
+}
+
+// List the .ckan files changed between base and head
+//
+// Fails if base is empty or no longer in the clone.
+func diffCommits(ctx context.Context, repo *git.Repository, base string, head *plumbing.Reference) ([]string, []string, error) {
+	if base == "" {
+		return nil, nil, errors.New("no base commit")
+	}
+	oldCommit, err := repo.CommitObject(plumbing.NewHash(base))
+	if err != nil {
+		return nil, nil, err
+	}
+	oldTree, err := oldCommit.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	newTree, err := headTree(repo, head)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, err := object.DiffTreeContext(ctx, oldTree, newTree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changed []string
+	var deleted []string
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, nil, err
+		}
+		from, to := change.From.Name, change.To.Name
+		if action == merkletrie.Delete || (from != "" && from != to) {
+			if isCKAN(from) {
+				deleted = append(deleted, from)
+			}
+		}
+		if action != merkletrie.Delete && isCKAN(to) {
+			changed = append(changed, to)
+		}
+	}
+	return changed, deleted, nil
+}
+
+// List every .ckan file in tree
+func ckanFiles(tree *object.Tree) ([]string, error) {
+	var files []string
+	err := tree.Files().ForEach(func(f *object.File) error {
+		if isCKAN(f.Name) {
+			files = append(files, f.Name)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Parse .ckan files from tree
+//
+// Blobs are read one at a time, parsing runs in parallel.
+func treeParser(tree *object.Tree) func(string) (ckan.Ckan, error) {
+	mu := &sync.Mutex{}
+	return func(path string) (ckan.Ckan, error) {
+		mu.Lock()
+		file, err := tree.File(path)
+		var contents string
+		if err == nil {
+			contents, err = file.Contents()
+		}
+		mu.Unlock()
+		if err != nil {
+			return ckan.Ckan{}, err
+		}
+		return parseCKANData([]byte(contents))
+	}
+}
+
+func headTree(repo *git.Repository, head *plumbing.Reference) (*object.Tree, error) {
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
+func isCKAN(path string) bool {
+	return strings.HasSuffix(path, ".ckan")
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/config"
+	"github.com/spf13/viper"
+	"github.com/tidwall/buntdb"
+)
+
+// Local stand in for the metadata repo
+type metaRepo struct {
+	t    *testing.T
+	dir  string
+	repo *git.Repository
+}
+
+func newMetaRepo(t *testing.T) *metaRepo {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &metaRepo{t: t, dir: dir, repo: repo}
+}
+
+func (m *metaRepo) write(name, abstract string) {
+	m.writeRaw(name+".ckan", testCKAN(name, abstract))
+}
+
+// Minimal valid .ckan file
+func testCKAN(name, abstract string) string {
+	return fmt.Sprintf(`{
+		"identifier": "%[1]s",
+		"name": "%[1]s",
+		"author": "tester",
+		"version": "1.0",
+		"abstract": "%[2]s",
+		"license": "MIT",
+		"download": "https://example.com/%[1]s.zip",
+		"install": [{"find": "%[1]s", "install_to": "GameData"}]
+	}`, name, abstract)
+}
+
+func (m *metaRepo) writeRaw(path, data string) {
+	if err := os.WriteFile(filepath.Join(m.dir, path), []byte(data), 0644); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func (m *metaRepo) commit() {
+	wt, err := m.repo.Worktree()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	if _, err := wt.Add("."); err != nil {
+		m.t.Fatal(err)
+	}
+	// pick up deletions too
+	_, err = wt.Commit("update", &git.CommitOptions{
+		All:    true,
+		Author: &object.Signature{Name: "tester", When: time.Now()},
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func storedAbstracts(t *testing.T, db *CkanDB) map[string]string {
+	found := make(map[string]string)
+	err := db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys("mod:*", func(key, value string) bool {
+			var mod ckan.Ckan
+			json.Unmarshal([]byte(value), &mod)
+			found[key] = mod.Abstract
+			return true
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestUpdateDBIncremental(t *testing.T) {
+	meta := newMetaRepo(t)
+	oldRepo := viper.GetString("settings.meta_repo")
+	oldHash := viper.GetString("settings.last_repo_hash")
+	viper.Set("settings.meta_repo", meta.dir)
+	t.Cleanup(func() {
+		viper.Set("settings.meta_repo", oldRepo)
+		viper.Set("settings.last_repo_hash", oldHash)
+		viper.WriteConfigAs(viper.ConfigFileUsed())
+	})
+
+	testDB := GetDB(filepath.Join(t.TempDir(), "test.db"))
+	defer testDB.Close()
+
+	meta.write("Alpha", "first")
+	meta.write("Beta", "second")
+	meta.commit()
+
+	if err := testDB.UpdateDB(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	found := storedAbstracts(t, testDB)
+	if len(found) != 2 || found["mod:CKAN-meta:Alpha.ckan"] != "first" || found["mod:CKAN-meta:Beta.ckan"] != "second" {
+		t.Fatalf("unexpected mods after first update: %v", found)
+	}
+
+	// a full rebuild would drop this
+	testDB.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set("mod:CKAN-meta:stray", "{}", nil)
+		return err
+	})
+
+	meta.write("Alpha", "changed")
+	if err := os.Remove(filepath.Join(meta.dir, "Beta.ckan")); err != nil {
+		t.Fatal(err)
+	}
+	meta.write("Gamma", "third")
+	meta.writeRaw("README.md", "not a mod")
+	meta.commit()
+
+	if err := testDB.UpdateDB(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	found = storedAbstracts(t, testDB)
+	if found["mod:CKAN-meta:Alpha.ckan"] != "changed" {
+		t.Errorf("Alpha not updated: %v", found)
+	}
+	if _, ok := found["mod:CKAN-meta:Beta.ckan"]; ok {
+		t.Errorf("Beta not deleted: %v", found)
+	}
+	if found["mod:CKAN-meta:Gamma.ckan"] != "third" {
+		t.Errorf("Gamma not added: %v", found)
+	}
+	if _, ok := found["mod:CKAN-meta:stray"]; !ok {
+		t.Errorf("update rebuilt every mod instead of applying the diff")
+	}
+
+	head, err := meta.repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testDB.repoHash(config.DefaultRepoName); got != head.Hash().String() {
+		t.Errorf("stored repo hash %v, want %v", got, head.Hash())
+	}
+}
+
+func TestUpdateDBMultipleRepos(t *testing.T) {
+	upstream := newMetaRepo(t)
+	upstream.write("Alpha", "upstream")
+	upstream.commit()
+	team := newMetaRepo(t)
+	team.write("Alpha", "patched")
+	team.write("Tool", "in-house")
+	team.commit()
+
+	oldHash := viper.GetString("settings.last_repo_hash")
+	viper.Set("settings.meta_repos", []map[string]interface{}{
+		{"name": "upstream", "url": upstream.dir, "priority": 0},
+		{"name": "team", "url": team.dir, "priority": 10},
+	})
+	t.Cleanup(func() {
+		viper.Set("settings.meta_repos", []map[string]interface{}{})
+		viper.Set("settings.last_repo_hash", oldHash)
+		viper.WriteConfigAs(viper.ConfigFileUsed())
+	})
+
+	testDB := GetDB(filepath.Join(t.TempDir(), "test.db"))
+	defer testDB.Close()
+
+	if err := testDB.UpdateDB(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	found := storedAbstracts(t, testDB)
+	if found["mod:upstream:Alpha.ckan"] != "upstream" || found["mod:team:Alpha.ckan"] != "patched" || found["mod:team:Tool.ckan"] != "in-house" {
+		t.Fatalf("unexpected mods: %v", found)
+	}
+
+	var source string
+	testDB.View(func(tx *buntdb.Tx) error {
+		val, _ := tx.Get("mod:team:Tool.ckan")
+		var mod ckan.Ckan
+		json.Unmarshal([]byte(val), &mod)
+		source = mod.SourceRepo
+		return nil
+	})
+	if source != "team" {
+		t.Errorf("source repo %q, want team", source)
+	}
+
+	// dropping a repo from the config removes its mods
+	viper.Set("settings.meta_repos", []map[string]interface{}{
+		{"name": "upstream", "url": upstream.dir, "priority": 0},
+	})
+	if err := testDB.UpdateDB(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	found = storedAbstracts(t, testDB)
+	if len(found) != 1 || found["mod:upstream:Alpha.ckan"] != "upstream" {
+		t.Errorf("unexpected mods after removing repo: %v", found)
+	}
+}
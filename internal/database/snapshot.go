@@ -0,0 +1,180 @@
+package database
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/config"
+	"github.com/jedwards1230/go-kerbal/internal/dirfs"
+)
+
+// Repo name the mods of a snapshot are stored under
+const snapshotRepo = config.SnapshotRepoName
+
+// Replace the mods of the previous snapshot with a local copy of CKAN-meta
+//
+// src is a .tar.gz or .zip snapshot, or a directory of .ckan files.
+// Unchanged snapshots are skipped unless force_update is set. Mods stored
+// from configured repos are kept, unless they were written in an outdated
+// layout that can no longer be read.
+func (c *CkanDB) importSnapshot(ctx context.Context, src string, force_update bool) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	hash, err := snapshotHash(src, info)
+	if err != nil {
+		return err
+	}
+	current := c.schemaCurrent()
+	if !force_update && current && c.repoHash(snapshotRepo) == hash {
+		log.Printf("No snapshot changes detected")
+		return nil
+	}
+
+	log.Printf("Importing metadata from %v", src)
+	fs, err := openSnapshot(src, info)
+	if err != nil {
+		return err
+	}
+
+	files := dirfs.FindFilePaths(fs, ".ckan")
+	err = c.updateMods(ctx, snapshotRepo, true, files, func(p string) (ckan.Ckan, error) {
+		return parseCKAN(fs, p)
+	}, nil, hash)
+	if err != nil {
+		return err
+	}
+
+	if !current {
+		return c.pruneRepos(snapshotRepo)
+	}
+	return nil
+}
+
+// Fingerprint a snapshot to tell if it changed since the last import
+//
+// Snapshots have no commit. Archives are tracked by their own size and
+// mtime, directories by those of every .ckan file inside, since editing a
+// nested file doesn't touch the top folder.
+func snapshotHash(src string, info os.FileInfo) (string, error) {
+	if !info.IsDir() {
+		return fmt.Sprintf("snapshot:%s:%d:%d", src, info.Size(), info.ModTime().UnixNano()), nil
+	}
+
+	h := sha1.New()
+	err := filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !isCKAN(p) {
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", p, fi.Size(), fi.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("snapshot:%s:%x", src, h.Sum(nil)), nil
+}
+
+// Open a snapshot as a filesystem, archives are unpacked into memory
+func openSnapshot(src string, info os.FileInfo) (billy.Filesystem, error) {
+	if info.IsDir() {
+		return osfs.New(src), nil
+	}
+
+	name := strings.ToLower(src)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return unzipSnapshot(src)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return untarSnapshot(src)
+	}
+	return nil, fmt.Errorf("unsupported metadata snapshot: %v", src)
+}
+
+func unzipSnapshot(src string) (billy.Filesystem, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	fs := memfs.New()
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !isCKAN(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		err = writeSnapshotFile(fs, f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+func untarSnapshot(src string) (billy.Filesystem, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	fs := memfs.New()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !isCKAN(hdr.Name) {
+			continue
+		}
+		if err := writeSnapshotFile(fs, hdr.Name, tr); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+func writeSnapshotFile(fs billy.Filesystem, name string, r io.Reader) error {
+	// keep archive entries inside the filesystem root
+	name = path.Clean("/" + name)
+	out, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, r)
+	return err
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/spf13/viper"
+)
+
+var snapshotMods = map[string]string{
+	"CKAN-meta-master/Alpha/Alpha-1.0.ckan": testCKAN("Alpha", "first"),
+	"CKAN-meta-master/Beta/Beta-1.0.ckan":   testCKAN("Beta", "second"),
+	"CKAN-meta-master/README.md":            "not a mod",
+}
+
+func writeZipSnapshot(t *testing.T, dest string) {
+	f, err := os.Create(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, data := range snapshotMods {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarSnapshot(t *testing.T, dest string) {
+	f, err := os.Create(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, data := range snapshotMods {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeDirSnapshot(t *testing.T, dest string) {
+	for name, data := range snapshotMods {
+		p := filepath.Join(dest, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImportSnapshot(t *testing.T) {
+	oldPath := viper.GetString("settings.meta_path")
+	t.Cleanup(func() { viper.Set("settings.meta_path", oldPath) })
+
+	tests := map[string]func(t *testing.T) string{
+		"zip": func(t *testing.T) string {
+			p := filepath.Join(t.TempDir(), "master.zip")
+			writeZipSnapshot(t, p)
+			return p
+		},
+		"tar.gz": func(t *testing.T) string {
+			p := filepath.Join(t.TempDir(), "master.tar.gz")
+			writeTarSnapshot(t, p)
+			return p
+		},
+		"dir": func(t *testing.T) string {
+			p := t.TempDir()
+			writeDirSnapshot(t, p)
+			return p
+		},
+	}
+
+	for name, create := range tests {
+		t.Run(name, func(t *testing.T) {
+			viper.Set("settings.meta_path", create(t))
+			testDB := GetDB(filepath.Join(t.TempDir(), "test.db"))
+			defer testDB.Close()
+
+			if err := testDB.UpdateDB(context.Background(), false); err != nil {
+				t.Fatal(err)
+			}
+			found := storedAbstracts(t, testDB)
+			if len(found) != 2 || found["mod:snapshot:/CKAN-meta-master/Alpha/Alpha-1.0.ckan"] != "first" {
+				t.Errorf("unexpected mods: %v", found)
+			}
+		})
+	}
+}
+
+func TestImportSnapshotKeepsRepos(t *testing.T) {
+	oldPath := viper.GetString("settings.meta_path")
+	t.Cleanup(func() { viper.Set("settings.meta_path", oldPath) })
+
+	testDB := GetDB(filepath.Join(t.TempDir(), "test.db"))
+	defer testDB.Close()
+	mod, err := parseCKANData([]byte(testCKAN("Gamma", "from repo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testDB.updateMods(context.Background(), "team", true, []string{"Gamma.ckan"}, func(string) (ckan.Ckan, error) {
+		return mod, nil
+	}, nil, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeDirSnapshot(t, dir)
+	viper.Set("settings.meta_path", dir)
+	if err := testDB.UpdateDB(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	found := storedAbstracts(t, testDB)
+	if found["mod:team:Gamma.ckan"] != "from repo" || len(found) != 3 {
+		t.Errorf("snapshot import removed repo mods: %v", found)
+	}
+	if testDB.repoHash("team") != "abc" {
+		t.Error("snapshot import removed repo commit")
+	}
+}
+
+func TestImportSnapshotUnsupported(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "master.rar")
+	if err := os.WriteFile(p, []byte("rar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testDB := GetDB(filepath.Join(t.TempDir(), "test.db"))
+	defer testDB.Close()
+
+	if err := testDB.importSnapshot(context.Background(), p, true); err == nil {
+		t.Error("expected error for unsupported snapshot")
+	}
+}
+
+func TestUpdateDBOffline(t *testing.T) {
+	meta := newMetaRepo(t)
+	oldRepo := viper.GetString("settings.meta_repo")
+	oldHash := viper.GetString("settings.last_repo_hash")
+	viper.Set("settings.meta_repo", meta.dir)
+	t.Cleanup(func() {
+		viper.Set("settings.meta_repo", oldRepo)
+		viper.Set("settings.last_repo_hash", oldHash)
+		viper.Set("settings.offline", false)
+		viper.WriteConfigAs(viper.ConfigFileUsed())
+	})
+
+	testDB := GetDB(filepath.Join(t.TempDir(), "test.db"))
+	defer testDB.Close()
+
+	// offline without a clone has nothing to read
+	viper.Set("settings.offline", true)
+	if err := testDB.UpdateDB(context.Background(), false); err == nil {
+		t.Fatal("expected error without a local clone")
+	}
+
+	meta.write("Alpha", "first")
+	meta.commit()
+	viper.Set("settings.offline", false)
+	if err := testDB.UpdateDB(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the remote is gone, but the clone is still there
+	os.RemoveAll(meta.dir)
+	viper.Set("settings.offline", true)
+	if err := testDB.UpdateDB(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if found := storedAbstracts(t, testDB); found["mod:CKAN-meta:Alpha.ckan"] != "first" {
+		t.Errorf("unexpected mods: %v", found)
+	}
+}
+
+func TestImportSnapshotDirChanges(t *testing.T) {
+	oldPath := viper.GetString("settings.meta_path")
+	t.Cleanup(func() { viper.Set("settings.meta_path", oldPath) })
+
+	dir := t.TempDir()
+	writeDirSnapshot(t, dir)
+	viper.Set("settings.meta_path", dir)
+	testDB := GetDB(filepath.Join(t.TempDir(), "test.db"))
+	defer testDB.Close()
+
+	if err := testDB.UpdateDB(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// editing a nested file leaves the top folder's mtime alone
+	top, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(dir, "CKAN-meta-master", "Alpha", "Alpha-1.0.ckan")
+	if err := os.WriteFile(nested, []byte(testCKAN("Alpha", "edited")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(nested, later, later)
+	os.Chtimes(dir, top.ModTime(), top.ModTime())
+
+	if err := testDB.UpdateDB(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if found := storedAbstracts(t, testDB); found["mod:snapshot:/CKAN-meta-master/Alpha/Alpha-1.0.ckan"] != "edited" {
+		t.Errorf("nested edit not imported: %v", found)
+	}
+}
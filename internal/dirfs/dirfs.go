@@ -3,6 +3,8 @@ package dirfs
 import (
 	"archive/zip"
 	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -191,6 +193,22 @@ func UnzipFile(f *zip.File, filePath string) error {
 	return nil
 }
 
+// Get the size and SHA-1 of a file
+func HashFile(filePath string) (int64, string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func CheckInstalledMods() (map[string]bool, error) {
 	cfg := config.GetConfig()
 	installedMods := make(map[string]bool, 0)
@@ -0,0 +1,288 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StatusError reports a response that is neither the file nor part of it
+type StatusError struct {
+	URL  string
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server code %v for %v", e.Code, e.URL)
+}
+
+// Called as a download advances with the bytes written so far and the
+// full size, or -1 if the server did not say
+type ProgressFunc func(done, total int64)
+
+// Client downloads mod archives within the configured limits
+//
+// One Client is shared by every download so the limits hold across all of
+// them.
+type Client struct {
+	HTTP  *http.Client
+	Retry Retry
+
+	slots   chan struct{}
+	perHost int
+	limiter *limiter
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// Limits bounds how hard downloads hit the network
+//
+// A zero field means no limit.
+type Limits struct {
+	Parallel    int
+	PerHost     int
+	BytesPerSec int64
+}
+
+func NewClient(httpClient *http.Client, retry Retry, limits Limits) *Client {
+	c := &Client{
+		HTTP:    httpClient,
+		Retry:   retry,
+		perHost: limits.PerHost,
+		hosts:   make(map[string]chan struct{}),
+	}
+	if limits.Parallel > 0 {
+		c.slots = make(chan struct{}, limits.Parallel)
+	}
+	if limits.BytesPerSec > 0 {
+		c.limiter = newLimiter(limits.BytesPerSec)
+	}
+	return c
+}
+
+// Wait for a free download slot, overall and for the url's host
+//
+// The returned function gives the slots back.
+func (c *Client) acquire(ctx context.Context, rawURL string) (func(), error) {
+	var host chan struct{}
+	if c.perHost > 0 {
+		name := rawURL
+		if u, err := url.Parse(rawURL); err == nil {
+			name = u.Host
+		}
+		c.mu.Lock()
+		host = c.hosts[name]
+		if host == nil {
+			host = make(chan struct{}, c.perHost)
+			c.hosts[name] = host
+		}
+		c.mu.Unlock()
+
+		select {
+		case host <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			if host != nil {
+				<-host
+			}
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() {
+		if c.slots != nil {
+			<-c.slots
+		}
+		if host != nil {
+			<-host
+		}
+	}, nil
+}
+
+// Download url into path, resuming a partial file left there by an
+// earlier attempt
+//
+// The partial file is kept when the transfer fails so the next call can
+// carry on from it. Servers that ignore Range requests get the whole file
+// again. progress may be nil. Cancelling ctx stops the transfer and keeps
+// what was written so far.
+func (c *Client) Fetch(ctx context.Context, url, path string, progress ProgressFunc) error {
+	release, err := c.acquire(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.get(ctx, url, offset)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			return c.restart(ctx, url, f, resp, progress)
+		}
+		log.Printf("Resuming %v at %d bytes", url, offset)
+	case http.StatusOK:
+		// Range ignored, start over
+		if err := truncate(f); err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file may already be complete
+		_, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err == nil && total == offset {
+			return nil
+		}
+		return c.restart(ctx, url, f, resp, progress)
+	default:
+		return &StatusError{URL: url, Code: resp.StatusCode}
+	}
+
+	return c.copyBody(ctx, f, resp, progress)
+}
+
+// Throw away a partial file that does not line up and download it whole
+func (c *Client) restart(ctx context.Context, url string, f *os.File, resp *http.Response, progress ProgressFunc) error {
+	resp.Body.Close()
+	if err := truncate(f); err != nil {
+		return err
+	}
+
+	resp, err := c.get(ctx, url, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{URL: url, Code: resp.StatusCode}
+	}
+	return c.copyBody(ctx, f, resp, progress)
+}
+
+func (c *Client) get(ctx context.Context, url string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	return c.HTTP.Do(req)
+}
+
+func truncate(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// Append the response body, failing if it ends early
+func (c *Client) copyBody(ctx context.Context, f *os.File, resp *http.Response, progress ProgressFunc) error {
+	var body io.Reader = resp.Body
+	if c.limiter != nil {
+		body = &limitedReader{ctx: ctx, r: body, l: c.limiter}
+	}
+
+	var w io.Writer = f
+	if progress != nil {
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+		w = &progressWriter{w: f, done: offset, total: total, progress: progress}
+		progress(offset, total)
+	}
+
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return io.ErrUnexpectedEOF
+	}
+	return f.Sync()
+}
+
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.done += int64(n)
+	pw.progress(pw.done, pw.total)
+	return n, err
+}
+
+// Read the start and total size from a Content-Range header
+//
+// A total of -1 means the server did not say.
+func parseContentRange(header string) (int64, int64, error) {
+	invalid := fmt.Errorf("invalid Content-Range: %q", header)
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, invalid
+	}
+	parts := strings.SplitN(strings.TrimPrefix(header, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, invalid
+	}
+
+	total := int64(-1)
+	if parts[1] != "*" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, invalid
+		}
+		total = n
+	}
+
+	start := int64(-1)
+	if parts[0] != "*" {
+		bounds := strings.SplitN(parts[0], "-", 2)
+		n, err := strconv.ParseInt(bounds[0], 10, 64)
+		if err != nil {
+			return 0, 0, invalid
+		}
+		start = n
+	}
+	return start, total, nil
+}
@@ -0,0 +1,314 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Serve data, cutting the connection after chunk bytes of every response
+func flakyServer(t *testing.T, data []byte, chunk int, ranges bool) (*httptest.Server, *[]string) {
+	requests := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests = append(requests, req.Header.Get("Range"))
+
+		start := 0
+		if r := req.Header.Get("Range"); ranges && r != "" {
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r, "bytes="), "-"))
+			if err != nil {
+				t.Errorf("bad range %q", r)
+			}
+			start = n
+		}
+		if start >= len(data) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(data)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)-start))
+		if start > 0 {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+
+		end := start + chunk
+		if end >= len(data) {
+			w.Write(data[start:])
+			return
+		}
+		w.Write(data[start:end])
+		w.(http.Flusher).Flush()
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func testData() []byte {
+	return bytes.Repeat([]byte("0123456789"), 1000)
+}
+
+func TestFetchResumes(t *testing.T) {
+	data := testData()
+	srv, requests := flakyServer(t, data, 3000, true)
+	client := NewClient(srv.Client(), Retry{}, Limits{})
+	path := filepath.Join(t.TempDir(), "mod.part")
+
+	var err error
+	attempts := 0
+	for attempts = 1; attempts <= 10; attempts++ {
+		if err = client.Fetch(context.Background(), srv.URL, path, nil); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("download never finished: %v", err)
+	}
+	if attempts != 4 {
+		t.Errorf("took %d attempts, want 4", attempts)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes, want %d", len(got), len(data))
+	}
+
+	want := []string{"", "bytes=3000-", "bytes=6000-", "bytes=9000-"}
+	if fmt.Sprint(*requests) != fmt.Sprint(want) {
+		t.Errorf("requests %q, want %q", *requests, want)
+	}
+
+	// a finished file is left alone
+	if err := client.Fetch(context.Background(), srv.URL, path, nil); err != nil {
+		t.Errorf("refetching complete file: %v", err)
+	}
+}
+
+func TestFetchWithoutRangeSupport(t *testing.T) {
+	data := testData()
+	path := filepath.Join(t.TempDir(), "mod.part")
+
+	// a partial file from an earlier attempt
+	if err := os.WriteFile(path, data[:4000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, _ := flakyServer(t, data, len(data), false)
+	if err := NewClient(srv.Client(), Retry{}, Limits{}).Fetch(context.Background(), srv.URL, path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestFetchStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	err := NewClient(srv.Client(), Retry{}, Limits{}).Fetch(context.Background(), srv.URL, filepath.Join(t.TempDir(), "mod.part"), nil)
+	if serr, ok := err.(*StatusError); !ok || serr.Code != http.StatusNotFound {
+		t.Errorf("expected a 404 StatusError, got %v", err)
+	}
+}
+
+func TestFetchWithRetry(t *testing.T) {
+	data := testData()
+	srv, requests := flakyServer(t, data, 4000, true)
+	path := filepath.Join(t.TempDir(), "mod.part")
+
+	var waits []time.Duration
+	retry := Retry{Attempts: 5, Backoff: time.Second, sleep: func(_ context.Context, d time.Duration) error { waits = append(waits, d); return nil }}
+	var done, total int64
+	progress := func(d, t int64) { done, total = d, t }
+	if err := NewClient(srv.Client(), retry, Limits{}).FetchWithRetry(context.Background(), srv.URL, path, progress); err != nil {
+		t.Fatal(err)
+	}
+	if done != int64(len(data)) || total != int64(len(data)) {
+		t.Errorf("last progress %d/%d, want %d/%d", done, total, len(data), len(data))
+	}
+	if len(*requests) != 3 {
+		t.Errorf("made %d requests, want 3", len(*requests))
+	}
+	if fmt.Sprint(waits) != "[1s 2s]" {
+		t.Errorf("waited %v, want [1s 2s]", waits)
+	}
+}
+
+func TestFetchWithRetryGivesUp(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if req.URL.Path == "/busy" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.NotFound(w, req)
+	}))
+	defer srv.Close()
+
+	retry := Retry{Attempts: 2, Backoff: time.Second, sleep: func(context.Context, time.Duration) error { return nil }}
+	client := NewClient(srv.Client(), retry, Limits{})
+
+	// missing files are not retried
+	err := client.FetchWithRetry(context.Background(), srv.URL+"/gone", filepath.Join(t.TempDir(), "a.part"), nil)
+	if Transient(err) || calls != 1 {
+		t.Errorf("404 tried %d times: %v", calls, err)
+	}
+
+	calls = 0
+	err = client.FetchWithRetry(context.Background(), srv.URL+"/busy", filepath.Join(t.TempDir(), "b.part"), nil)
+	if !Transient(err) || calls != 3 {
+		t.Errorf("503 tried %d times: %v", calls, err)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&StatusError{URL: "u", Code: http.StatusNotFound}, true},
+		{fmt.Errorf("get: %w", errors.New("connection reset")), true},
+		{&os.PathError{Op: "write", Path: "a.part", Err: errors.New("no space left on device")}, false},
+		{context.Canceled, false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if got := Remote(test.err); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.err, got, test.want)
+		}
+	}
+	if Transient(&os.PathError{Op: "write", Path: "a.part", Err: errors.New("disk full")}) {
+		t.Error("local write error retried")
+	}
+}
+
+func TestPerHostLimit(t *testing.T) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("zip"))
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.Client(), Retry{}, Limits{Parallel: 4, PerHost: 2})
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := client.Fetch(context.Background(), srv.URL, filepath.Join(dir, strconv.Itoa(i)), nil); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("%d downloads ran at once from one host, want at most 2", peak)
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	data := testData()
+	srv, _ := flakyServer(t, data, len(data), true)
+	client := NewClient(srv.Client(), Retry{}, Limits{BytesPerSec: 20000})
+
+	start := time.Now()
+	if err := client.Fetch(context.Background(), srv.URL, filepath.Join(t.TempDir(), "mod.part"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10000 bytes at 20000 bytes per second from an empty bucket
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("download took %v, want at least 500ms", elapsed)
+	}
+}
+
+func TestFetchCancel(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", "6")
+		w.Write([]byte("abc"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	path := filepath.Join(t.TempDir(), "mod.part")
+	progress := func(done, total int64) {
+		if done == 3 {
+			cancel()
+		}
+	}
+
+	err := NewClient(srv.Client(), Retry{Attempts: 3}, Limits{}).FetchWithRetry(ctx, srv.URL, path, progress)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "abc" {
+		t.Errorf("partial file holds %q, want %q", got, "abc")
+	}
+}
+
+func TestLimiterWaitCancel(t *testing.T) {
+	l := newLimiter(10)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// 100 bytes at 10 bytes per second would sleep for ten seconds
+	start := time.Now()
+	if err := l.wait(ctx, 100); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wait took %v after cancellation", elapsed)
+	}
+}
@@ -0,0 +1,71 @@
+package download
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Token bucket shared by every download to cap total bandwidth
+//
+// At most one second of traffic can build up while downloads are idle.
+type limiter struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(bytesPerSec int64) *limiter {
+	return &limiter{rate: float64(bytesPerSec), last: time.Now()}
+}
+
+// Take n bytes from the bucket, sleeping until they are paid for
+//
+// Returns early with the context's error if ctx is cancelled first.
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *limiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// small reads keep slow limits smooth
+	if max := int(lr.l.rate / 10); max > 0 && len(p) > max {
+		p = p[:max]
+	}
+	n, err := lr.r.Read(p)
+	if werr := lr.l.wait(lr.ctx, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
@@ -0,0 +1,95 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Longest wait between two attempts
+const maxBackoff = 30 * time.Second
+
+// Retry controls how often a failed download is tried again
+//
+// The wait starts at Backoff and doubles after every failed attempt.
+type Retry struct {
+	Attempts int
+	Backoff  time.Duration
+
+	// waits between attempts, returning early if ctx is cancelled
+	sleep func(context.Context, time.Duration) error
+}
+
+// Download like Fetch, trying again after transient failures
+//
+// Every attempt resumes the partial file left by the one before.
+func (c *Client) FetchWithRetry(ctx context.Context, url, path string, progress ProgressFunc) error {
+	retry := c.Retry
+	sleep := retry.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	wait := retry.Backoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = c.Fetch(ctx, url, path, progress)
+		if err == nil || ctx.Err() != nil || !Transient(err) || attempt >= retry.Attempts {
+			return err
+		}
+
+		log.Printf("Retrying %v in %v: %v", url, wait, err)
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+		wait *= 2
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns true if the server or the network failed the download
+//
+// Cancellation and errors writing the local file, such as a full disk, are
+// not remote failures.
+func Remote(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var perr *os.PathError
+	return !errors.As(err, &perr)
+}
+
+// Returns true if trying the download again might help
+//
+// Network errors and server overload are transient. Other error statuses,
+// such as a missing file, are not.
+func Transient(err error) bool {
+	if !Remote(err) {
+		return false
+	}
+	var serr *StatusError
+	if !errors.As(err, &serr) {
+		return true
+	}
+	switch serr.Code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return serr.Code >= 500
+}
@@ -10,6 +10,7 @@ const spacebar = " "
 // details.
 type KeyMap struct {
 	Quit     key.Binding
+	Cancel   key.Binding
 	Down     key.Binding
 	Up       key.Binding
 	Left     key.Binding
@@ -38,6 +39,10 @@ func New() KeyMap {
 			key.WithKeys("ctrl+c"),
 			key.WithHelp("ctrl+c", "quit"),
 		),
+		Cancel: key.NewBinding(
+			key.WithKeys("ctrl+x"),
+			key.WithHelp("ctrl+x", "cancel running task"),
+		),
 		Down: key.NewBinding(
 			key.WithKeys("down"),
 			key.WithHelp("↓", "move down"),
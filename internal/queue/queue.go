@@ -3,7 +3,34 @@ package queue
 import mod "github.com/jedwards1230/go-kerbal/internal/ckan"
 
 type Queue struct {
-	List map[string]map[string]mod.Ckan
+	List    map[string]map[string]mod.Ckan
+	Choices map[string]Choice
+}
+
+// Choice is a dependency with several alternatives that the user must pick from
+type Choice struct {
+	Requester string
+	Help      string
+	Options   []mod.Ckan
+}
+
+// Unique key for the choice
+func (c Choice) Key() string {
+	key := c.Requester
+	for _, option := range c.Options {
+		key += ":" + option.Identifier
+	}
+	return key
+}
+
+// Returns true if s is one of the alternatives
+func (c Choice) HasOption(s string) bool {
+	for _, option := range c.Options {
+		if option.Identifier == s {
+			return true
+		}
+	}
+	return false
 }
 
 func New() Queue {
@@ -14,16 +41,18 @@ func New() Queue {
 	q["dependency"] = make(map[string]mod.Ckan, 0)
 
 	return Queue{
-		List: q,
+		List:    q,
+		Choices: make(map[string]Choice, 0),
 	}
 }
 
-func (q *Queue) FindDependents(s string) []mod.Ckan {
+// Find selections that depend on the given mod
+func (q *Queue) FindDependents(dependency mod.Ckan) []mod.Ckan {
 	modList := make([]mod.Ckan, 0)
 	for _, mod := range q.GetSelections() {
 		if len(mod.ModDepends) > 0 {
 			for i := range mod.ModDepends {
-				if mod.ModDepends[i] == s {
+				if mod.ModDepends[i].SatisfiedBy(dependency) {
 					modList = append(modList, mod)
 				}
 			}
@@ -96,6 +125,55 @@ func (q Queue) GetDependencies() map[string]mod.Ckan {
 	return q.List["dependency"]
 }
 
+func (q *Queue) ClearDependencies() {
+	q.List["dependency"] = make(map[string]mod.Ckan, 0)
+}
+
+func (q *Queue) AddChoice(c Choice) {
+	q.Choices[c.Key()] = c
+}
+
+func (q Queue) GetChoices() map[string]Choice {
+	return q.Choices
+}
+
+func (q *Queue) ClearChoices() {
+	q.Choices = make(map[string]Choice, 0)
+}
+
+// Returns true if s is offered by a pending choice
+func (q Queue) IsChoiceOption(s string) bool {
+	_, ok := q.GetChoiceOption(s)
+	return ok
+}
+
+// Find an alternative offered by a pending choice
+func (q Queue) GetChoiceOption(s string) (mod.Ckan, bool) {
+	for _, c := range q.Choices {
+		for _, option := range c.Options {
+			if option.Identifier == s {
+				return option, true
+			}
+		}
+	}
+	return mod.Ckan{}, false
+}
+
+// List the mods waiting on a choice that offers s
+func (q Queue) ChoiceRequesters(s string) []string {
+	requesters := make([]string, 0)
+	for _, c := range q.Choices {
+		if c.HasOption(s) {
+			requesters = append(requesters, c.Requester)
+		}
+	}
+	return requesters
+}
+
+func (q Queue) ChoiceLen() int {
+	return len(q.Choices)
+}
+
 func (q Queue) InstallLen() int {
 	count := 0
 	for _, mod := range q.GetSelections() {
@@ -130,12 +208,13 @@ func (q *Queue) RemoveFromQueue(s string) error {
 	for _, mod := range q.GetSelections() {
 		if mod.Identifier == s {
 			q.RemoveSelection(mod.Identifier)
+			q.removeChoicesFor(mod.Identifier)
 			// remove any dependencies
 			// todo: only remove if no other mods depend on it
 			if len(mod.ModDepends) > 0 {
 				for i := range mod.ModDepends {
 					for _, dependent := range q.GetDependencies() {
-						if dependent.Identifier == mod.ModDepends[i] {
+						if mod.ModDepends[i].SatisfiedBy(dependent) {
 							q.RemoveDependency(dependent.Identifier)
 						}
 					}
@@ -146,12 +225,23 @@ func (q *Queue) RemoveFromQueue(s string) error {
 	// check dependency queue
 	for _, mod := range q.GetDependencies() {
 		if mod.Identifier == s {
-			mods := q.FindDependents(s)
+			mods := q.FindDependents(mod)
 			for i := range mods {
 				q.RemoveSelection(mods[i].Identifier)
+				q.removeChoicesFor(mods[i].Identifier)
 			}
 			q.RemoveDependency(mod.Identifier)
+			q.removeChoicesFor(mod.Identifier)
 		}
 	}
 	return nil
 }
+
+// Drop pending choices requested by s
+func (q *Queue) removeChoicesFor(s string) {
+	for key, c := range q.Choices {
+		if c.Requester == s {
+			delete(q.Choices, key)
+		}
+	}
+}
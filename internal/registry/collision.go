@@ -0,0 +1,206 @@
+package registry
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/dirfs"
+)
+
+// Files a queued mod will write, read from its downloaded archive
+type installPlan struct {
+	Mod   ckan.Ckan
+	Files []installFile
+
+	zip *zip.ReadCloser
+}
+
+func (p installPlan) Close() error {
+	if p.zip == nil {
+		return nil
+	}
+	return p.zip.Close()
+}
+
+// Open the archive of every mod and map the files it installs
+//
+// Archives stay open until the returned plans are closed.
+func (r *Registry) planInstalls(mods []ckan.Ckan) ([]installPlan, error) {
+	plans := make([]installPlan, 0, len(mods))
+	for _, mod := range mods {
+		archive, ok := r.Cache.Get(archiveKey(mod))
+		if !ok {
+			closePlans(plans)
+			return nil, fmt.Errorf("%s: not downloaded", mod.Name)
+		}
+		// the cache may have been changed since the download
+		r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseVerifying})
+		if err := r.verifyCached(mod, archive); err != nil {
+			r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseFailed, Err: err})
+			closePlans(plans)
+			return nil, err
+		}
+		zipReader, err := zip.OpenReader(archive)
+		if err != nil {
+			closePlans(plans)
+			return nil, fmt.Errorf("%s: opening zip file: %v", mod.Name, archive)
+		}
+
+		files, err := mapInstallFiles(mod, zipReader.File)
+		if err != nil {
+			zipReader.Close()
+			closePlans(plans)
+			return nil, fmt.Errorf("%s: %v", mod.Name, err)
+		}
+		plans = append(plans, installPlan{Mod: mod, Files: files, zip: zipReader})
+	}
+	return plans, nil
+}
+
+func closePlans(plans []installPlan) {
+	for _, plan := range plans {
+		plan.Close()
+	}
+}
+
+// Check no two mods write the same file
+//
+// Queued mods are compared against each other, against files recorded for
+// installed mods and against files already in kerbalDir that no install
+// record covers. Byte-identical files, such as a bundled shared DLL, are
+// allowed.
+func (r *Registry) checkCollisions(kerbalDir string, plans []installPlan) error {
+	type claim struct {
+		owner string
+		entry *zip.File
+	}
+
+	recorded := make(map[string]bool)
+	for _, manifest := range r.Manifests {
+		for _, owned := range manifest.Files {
+			recorded[strings.ToLower(owned.Path)] = true
+		}
+	}
+
+	collisions := make([]string, 0)
+	claimed := make(map[string]claim)
+	for _, plan := range plans {
+		for _, file := range plan.Files {
+			key := strings.ToLower(file.Target)
+
+			if other, ok := claimed[key]; ok && other.owner != plan.Mod.Identifier {
+				if !sameEntry(other.entry, file.Entry) {
+					collisions = append(collisions, fmt.Sprintf("%v and %v both install %v", plan.Mod.Name, other.owner, file.Target))
+				}
+				continue
+			}
+			claimed[key] = claim{owner: plan.Mod.Identifier, entry: file.Entry}
+
+			for id, manifest := range r.Manifests {
+				if id == plan.Mod.Identifier || r.Queue.CheckRemovals(id) {
+					continue
+				}
+				for _, owned := range manifest.Files {
+					if !strings.EqualFold(owned.Path, file.Target) {
+						continue
+					}
+					if sum, err := hashEntry(file.Entry); err != nil || sum != owned.Sha1 {
+						collisions = append(collisions, fmt.Sprintf("%v would overwrite %v owned by installed %v", plan.Mod.Name, file.Target, id))
+					}
+				}
+			}
+			if recorded[key] {
+				continue
+			}
+
+			// files of mods installed before install records were kept,
+			// or put there by hand
+			_, onDisk, err := dirfs.HashFile(filepath.Join(kerbalDir, filepath.FromSlash(file.Target)))
+			if err != nil {
+				continue
+			}
+			owner := r.untrackedOwner(file.Target)
+			if owner == plan.Mod.Identifier || r.Queue.CheckRemovals(owner) {
+				continue
+			}
+			if sum, err := hashEntry(file.Entry); err != nil || sum != onDisk {
+				if owner == "" {
+					collisions = append(collisions, fmt.Sprintf("%v would overwrite untracked file %v", plan.Mod.Name, file.Target))
+				} else {
+					collisions = append(collisions, fmt.Sprintf("%v would overwrite %v owned by installed %v", plan.Mod.Name, file.Target, owner))
+				}
+			}
+		}
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return errors.New("file conflicts: " + strings.Join(collisions, "; "))
+	}
+	return nil
+}
+
+// Identifier of the installed mod without an install record whose GameData
+// folder holds target, or "" if none can be found
+func (r *Registry) untrackedOwner(target string) string {
+	parts := strings.Split(target, "/")
+	if len(parts) < 3 || parts[0] != "GameData" {
+		return ""
+	}
+	for id, mod := range r.InstalledModList {
+		if _, ok := r.Manifests[id]; ok {
+			continue
+		}
+		names, patterns := gameDataNames(mod, false)
+		for _, name := range names {
+			if strings.EqualFold(name, parts[1]) {
+				return id
+			}
+		}
+		for _, re := range patterns {
+			if re.FindString(parts[1]) == parts[1] {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// Returns true if two archive entries hold the same bytes
+func sameEntry(a, b *zip.File) bool {
+	if a.UncompressedSize64 != b.UncompressedSize64 || a.CRC32 != b.CRC32 {
+		return false
+	}
+	sumA, err := hashEntry(a)
+	if err != nil {
+		return false
+	}
+	sumB, err := hashEntry(b)
+	if err != nil {
+		return false
+	}
+	return sumA == sumB
+}
+
+// SHA-1 of an archive entry's contents
+func hashEntry(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/database"
+	"github.com/jedwards1230/go-kerbal/internal/queue"
+)
+
+func testEntry(t *testing.T, name, content string) *zip.File {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(content))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.File[0]
+}
+
+func testPlan(mod ckan.Ckan, files ...installFile) installPlan {
+	return installPlan{Mod: mod, Files: files}
+}
+
+func TestCheckCollisions(t *testing.T) {
+	r := &Registry{Queue: queue.New()}
+
+	shared := installFile{testEntry(t, "Lib.dll", "same"), "GameData/Lib.dll"}
+	sharedCopy := installFile{testEntry(t, "Lib.dll", "same"), "GameData/Lib.dll"}
+	if err := r.checkCollisions(t.TempDir(), []installPlan{
+		testPlan(testMod("A", "1.0"), shared),
+		testPlan(testMod("B", "1.0"), sharedCopy),
+	}); err != nil {
+		t.Errorf("identical files should not collide: %v", err)
+	}
+
+	different := installFile{testEntry(t, "Lib.dll", "other"), "GameData/Lib.dll"}
+	err := r.checkCollisions(t.TempDir(), []installPlan{
+		testPlan(testMod("A", "1.0"), shared),
+		testPlan(testMod("B", "1.0"), different),
+	})
+	if err == nil || !strings.Contains(err.Error(), "GameData/Lib.dll") {
+		t.Errorf("expected collision between queued mods, got %v", err)
+	}
+
+	r.Manifests = map[string]database.InstalledMod{
+		"C": {Identifier: "C", Files: []database.InstalledFile{{Path: "GameData/Lib.dll", Sha1: "0000"}}},
+	}
+	err = r.checkCollisions(t.TempDir(), []installPlan{testPlan(testMod("A", "1.0"), shared)})
+	if err == nil || !strings.Contains(err.Error(), "installed C") {
+		t.Errorf("expected collision with installed mod, got %v", err)
+	}
+}
+
+func TestCheckCollisionsUntracked(t *testing.T) {
+	kerbalDir := t.TempDir()
+	for name, content := range map[string]string{
+		"GameData/Lib.dll":            "other",
+		"GameData/Same.dll":           "same",
+		"GameData/Legacy/Plugin.dll":  "old",
+		"GameData/Removed/Plugin.dll": "old",
+	} {
+		path := filepath.Join(kerbalDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	legacy := testMod("Legacy", "1.0")
+	legacy.Install.Stanzas = []ckan.InstallStanza{{Find: "Legacy", InstallTo: "GameData"}}
+	removed := testMod("Removed", "1.0")
+	removed.Install.Stanzas = []ckan.InstallStanza{{Find: "Removed", InstallTo: "GameData"}}
+	r := &Registry{
+		Queue:            queue.New(),
+		InstalledModList: map[string]ckan.Ckan{"Legacy": legacy, "Removed": removed},
+	}
+	r.Queue.AddRemoval(removed)
+
+	err := r.checkCollisions(kerbalDir, []installPlan{testPlan(testMod("A", "1.0"),
+		installFile{testEntry(t, "Lib.dll", "same"), "GameData/Lib.dll"},
+		installFile{testEntry(t, "Same.dll", "same"), "GameData/Same.dll"},
+		installFile{testEntry(t, "Plugin.dll", "new"), "GameData/Legacy/Plugin.dll"},
+		installFile{testEntry(t, "Plugin.dll", "new"), "GameData/Removed/Plugin.dll"},
+	)})
+	if err == nil {
+		t.Fatal("expected collision with files on disk")
+	}
+	for _, want := range []string{"untracked file GameData/Lib.dll", "GameData/Legacy/Plugin.dll owned by installed Legacy"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+	for _, unwanted := range []string{"Same.dll", "Removed"} {
+		if strings.Contains(err.Error(), unwanted) {
+			t.Errorf("unexpected %q in %v", unwanted, err)
+		}
+	}
+
+	// the same mod replacing its own files
+	if err := r.checkCollisions(kerbalDir, []installPlan{testPlan(testMod("Legacy", "2.0"),
+		installFile{testEntry(t, "Plugin.dll", "new"), "GameData/Legacy/Plugin.dll"},
+	)}); err != nil {
+		t.Errorf("upgrade should not collide with its own files: %v", err)
+	}
+}
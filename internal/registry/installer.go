@@ -1,105 +1,162 @@
 package registry
 
 import (
-	"archive/zip"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/jedwards1230/go-kerbal/internal/cache"
 	"github.com/jedwards1230/go-kerbal/internal/ckan"
 	"github.com/jedwards1230/go-kerbal/internal/common"
 	"github.com/jedwards1230/go-kerbal/internal/config"
-	"github.com/jedwards1230/go-kerbal/internal/dirfs"
+	"github.com/jedwards1230/go-kerbal/internal/database"
+	"github.com/jedwards1230/go-kerbal/internal/download"
 	"golang.org/x/sync/errgroup"
 )
 
 func (r *Registry) AddToQueue(mod ckan.Ckan) error {
 	if mod.Installed() {
 		r.Queue.AddRemoval(mod)
+		if err := r.ResolveQueue(); err != nil {
+			r.Queue.RemoveRemoval(mod.Identifier)
+			return err
+		}
+		return nil
+	}
+
+	// picking an alternative resolves the choices offering it
+	choice := r.Queue.IsChoiceOption(mod.Identifier)
+	if choice {
+		r.Queue.AddDependency(mod)
 	} else {
 		r.Queue.AddSelection(mod)
+	}
 
-		mods, err := r.CheckDependencies(mod)
-		if err != nil {
-			return err
-		}
-		if len(mods) > 0 {
-			for _, mod := range mods {
-				if r.Queue.CheckRemovals(mod.Identifier) {
-					common.LogError("dependent mod being removed!!!!")
-				}
-				r.Queue.AddDependency(mod)
-			}
+	// a failed resolve leaves the rest of the queue and its choices as they were
+	err := r.ResolveQueue()
+	if err != nil {
+		if choice {
+			r.Queue.RemoveDependency(mod.Identifier)
+		} else {
+			r.Queue.RemoveFromQueue(mod.Identifier)
 		}
+		return err
 	}
 	return nil
 }
 
-func (r *Registry) RemoveMods() error {
-	for _, mod := range r.Queue.GetRemovals() {
-		err := r.removeMod(mod)
-		if err != nil {
-			return err
-		}
+func (r *Registry) RemoveFromQueue(s string) error {
+	err := r.Queue.RemoveFromQueue(s)
+	if err != nil {
+		return err
 	}
-	return nil
+	return r.ResolveQueue()
 }
 
-func (r *Registry) removeMod(mod ckan.Ckan) error {
-	common.LogErrorf("Removing %v", mod.Name)
-
-	// find path
-	cfg := config.GetConfig()
+// Rebuild queued dependencies and choices from the current selections
+func (r *Registry) ResolveQueue() error {
+	installed := make(map[string]ckan.Ckan, len(r.InstalledModList))
+	for id, mod := range r.InstalledModList {
+		if !r.Queue.CheckRemovals(id) {
+			installed[id] = mod
+		}
+	}
 
-	// get Kerbal folder
-	destination, err := filepath.Abs(cfg.Settings.KerbalDir + "/GameData")
+	plan, err := r.Resolve(r.Queue.GetSelections(), installed, r.Queue.GetDependencies())
 	if err != nil {
-		return fmt.Errorf("cannot get KSP dir: %v", err)
+		return err
 	}
 
-	files, err := ioutil.ReadDir(destination)
+	// removing a mod the queue still needs would break the install
+	required := make([]string, 0)
+	for id, mod := range plan.Install {
+		if r.Queue.CheckRemovals(id) {
+			required = append(required, mod.Name)
+		}
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		return fmt.Errorf("queued for removal but required: %v", strings.Join(required, ", "))
+	}
+
+	r.Queue.ClearDependencies()
+	r.Queue.ClearChoices()
+	for id, mod := range plan.Install {
+		if _, ok := r.Queue.GetSelections()[id]; ok {
+			// older versions may have been picked to satisfy constraints
+			r.Queue.AddSelection(mod)
+		} else {
+			r.Queue.AddDependency(mod)
+		}
+	}
+	for _, choice := range plan.Choices {
+		common.LogWarningf("Choice required: %v", choice.Help)
+		r.Queue.AddChoice(choice)
+	}
+
+	if len(plan.Install) > len(r.Queue.GetSelections()) {
+		log.Printf("Found %d dependencies", len(plan.Install)-len(r.Queue.GetSelections()))
+	}
+	return nil
+}
+
+// Queue the files of a mod for deletion
+func (r *Registry) stageRemoval(tx *Transaction, mod ckan.Ckan) error {
+	if manifest, ok := r.Manifests[mod.Identifier]; ok {
+		r.stageManifestRemoval(tx, manifest)
+		return nil
+	}
+
+	// mods installed before install records were kept
+	common.LogWarningf("No install record for %v, removing by folder name", mod.Name)
+
+	files, err := ioutil.ReadDir(filepath.Join(tx.KerbalDir, "GameData"))
 	if err != nil {
 		return err
 	}
 
-	var removePath string
+	names, patterns := gameDataNames(mod, false)
+	removePaths := make([]string, 0)
 	for _, f := range files {
 		modName := f.Name()
-		if mod.Install.Find != "" {
-			if strings.Contains(modName, mod.Install.Find) {
-				removePath = modName
-			}
-		} else if mod.Install.File != "" {
-			if strings.Contains(modName, mod.Install.File) {
-				removePath = modName
+		if modName == "Squad" || modName == "SquadExpansion" {
+			continue
+		}
+		for _, name := range names {
+			if modName == name {
+				removePaths = append(removePaths, modName)
 			}
-		} else if mod.Install.FindRegex != "" {
-			re := regexp.MustCompile(mod.Install.FindRegex)
-			if re.MatchString(mod.Install.FindRegex) {
-				removePath = modName
+		}
+		// an unanchored pattern would also take folders of other mods
+		for _, re := range patterns {
+			if re.FindString(modName) == modName {
+				removePaths = append(removePaths, modName)
 			}
-		} else {
-			common.LogErrorf("Cannot find for %v", mod.Name)
 		}
 	}
-	removePath = destination + "/" + removePath
-	//r.LogErrorf("Deleting \"%v\"", removePath)
-	err = os.RemoveAll(removePath)
-	if err != nil {
-		return fmt.Errorf("cannot remove mod %s: %v", mod.Name, err)
+	if len(removePaths) == 0 {
+		return fmt.Errorf("cannot find files for %s", mod.Name)
+	}
+
+	for _, removePath := range removePaths {
+		// a recorded mod installed into the same folder
+		if owner := r.dirOwner("GameData/"+removePath, mod.Identifier); owner != "" {
+			common.LogWarningf("Keeping GameData/%v, also installed by %v", removePath, owner)
+			continue
+		}
+		tx.Delete("GameData/" + removePath)
 	}
 	return nil
 }
 
 // Download selected mods
-func (r *Registry) DownloadMods() error {
+func (r *Registry) DownloadMods(ctx context.Context) error {
 	var mods []ckan.Ckan
 	var err error
 
@@ -119,219 +176,378 @@ func (r *Registry) DownloadMods() error {
 	}
 
 	if len(mods) > 0 {
-		common.LogCommandf("Downloading %d mods", len(mods))
-
-		// download mods
-		g := new(errgroup.Group)
-		for i := range mods {
-			mod := mods[i]
-			g.Go(func() error {
-				err := r.downloadMod(mod)
-				if err != nil {
-					return fmt.Errorf("%s: %v", mod.Name, err)
-				}
-				mod.MarkDownloaded()
-				return nil
-			})
+		return r.FillCache(ctx, mods)
+	}
+	return errors.New("no URLS provided")
+}
+
+// Download any archives missing from the cache
+//
+// Every mod is queued at once and the downloader's limits decide how many
+// transfers run together. Once done, the cache is trimmed to its size limit
+// without touching the archives just requested.
+func (r *Registry) FillCache(ctx context.Context, mods []ckan.Ckan) error {
+	common.LogCommandf("Downloading %d mods", len(mods))
+
+	for _, mod := range mods {
+		r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseQueued, Total: mod.Download.Size})
+	}
+
+	// download mods
+	g := new(errgroup.Group)
+	for i := range mods {
+		mod := mods[i]
+		g.Go(func() error {
+			err := r.downloadMod(ctx, mod)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseFailed, Err: err})
+			}
+			var verr *VerifyError
+			if errors.As(err, &verr) {
+				return err
+			} else if err != nil {
+				return fmt.Errorf("%s: %v", mod.Name, err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(mods))
+	for _, mod := range mods {
+		keep[archiveKey(mod)] = true
+	}
+	if err := r.Cache.Evict(keep); err != nil {
+		common.LogErrorf("Error trimming cache: %v", err)
+	}
+	return nil
+}
+
+// Download mods into the cache ahead of installing them
+//
+// Each identifier gets its latest compatible version. With no identifiers,
+// the installed version of every installed mod is cached instead.
+func (r *Registry) PrefillCache(ctx context.Context, ids []string) ([]ckan.Ckan, error) {
+	if len(r.TotalModMap) == 0 {
+		r.TotalModMap = r.GetEntireModList()
+	}
+
+	var mods []ckan.Ckan
+	if len(ids) == 0 {
+		for _, mod := range r.InstalledModList {
+			mods = append(mods, mod)
 		}
-		if err := g.Wait(); err != nil {
-			return err
+	} else {
+		versions := gameVersions(config.GetConfig())
+		latest := getLatestVersionMap(getCompatibleModMap(r.TotalModMap, versions))
+		for _, id := range ids {
+			mod, ok := latest[id]
+			if !ok {
+				return nil, fmt.Errorf("no compatible version of %v", id)
+			}
+			mods = append(mods, mod)
 		}
-		return nil
 	}
-	return errors.New("no URLS provided")
+
+	if len(mods) == 0 {
+		return mods, nil
+	}
+	return mods, r.FillCache(ctx, mods)
 }
 
 // Download a mod
-func (r *Registry) downloadMod(mod ckan.Ckan) error {
-	resp, err := http.Get(mod.Download.URL)
-	if err != nil {
-		return err
+func (r *Registry) downloadMod(ctx context.Context, mod ckan.Ckan) error {
+	key := archiveKey(mod)
+	if _, ok := r.Cache.Get(key); ok {
+		log.Printf("Using cached: %v", mod.Name)
+		r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseCached})
+		return nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("server code: %v", resp.StatusCode)
+	progress := func(done, total int64) {
+		r.reportBytes(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseDownloading, Done: done, Total: total})
 	}
 
-	// Create zip file
-	out, err := os.Create(r.GetTempDir() + mod.Download.Path)
+	// partial downloads stay in the cache so a later attempt can resume
+	part := r.Cache.PartPath(key, archiveLabel(mod))
+	source := mod.Download.URL
+	err := r.Downloader.FetchWithRetry(ctx, source, part, progress)
 	if err != nil {
-		return fmt.Errorf("creating file: %v", err)
+		// only a dead or unreachable source is worth trying elsewhere
+		mirror := mod.MirrorURL()
+		if mirror == "" || ctx.Err() != nil || !download.Remote(err) {
+			return err
+		}
+		common.LogWarningf("%v: %v, trying Internet Archive", mod.Name, err)
+
+		// the mirror's partial file must not build on the original's
+		os.Remove(part)
+		source = mirror
+		if mirrorErr := r.Downloader.FetchWithRetry(ctx, source, part, progress); mirrorErr != nil {
+			return fmt.Errorf("%v; mirror: %v", err, mirrorErr)
+		}
 	}
-	defer out.Close()
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
+	archive, err := r.Cache.Commit(key, archiveLabel(mod), part)
 	if err != nil {
-		return fmt.Errorf("could not copy contents to file: %v", err)
+		return fmt.Errorf("could not move download into cache: %v", err)
+	}
+	r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseVerifying})
+	if err := r.verifyCached(mod, archive); err != nil {
+		return err
 	}
 
-	// Add mod to install queue if successfully downloaded
-	log.Printf("Downloaded: %v", mod.Name)
+	log.Printf("Downloaded: %v from %v", mod.Name, source)
+	r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseCached})
 
 	return nil
 }
 
-// Install mods in the registry install queue
-func (r *Registry) InstallMods() error {
-	if r.Queue.InstallLen() > 0 {
+// Cache key of a mod's archive
+func archiveKey(mod ckan.Ckan) string {
+	return cache.Key(mod.Download.URL, mod.Download.Hash())
+}
 
-		// install dependencies
-		for _, mod := range r.Queue.GetDependencies() {
-			if !mod.Installed() {
-				err := r.installMod(&mod)
-				if err != nil {
-					return fmt.Errorf("%s: %v", mod.Name, err)
-				}
-				mod.SetInstalled(true)
-			}
-		}
+// Readable name of a mod's archive in the cache
+func archiveLabel(mod ckan.Ckan) string {
+	return mod.Identifier + "-" + mod.Versions.Mod.String()
+}
 
-		// install the rest
-		for _, mod := range r.Queue.GetSelections() {
-			if !mod.Installed() {
-				err := r.installMod(&mod)
-				if err != nil {
-					return fmt.Errorf("%s: %v", mod.Name, err)
-				}
-				mod.SetInstalled(true)
-			}
-		}
+// Apply the queue to the KSP instance in a single transaction
+//
+// Removed files are backed up and new ones staged before anything in the
+// game folder changes. Archives are checked for file collisions first. If
+// any step fails, the game folder is restored to how it was.
+//
+// Cancelling ctx before the commit leaves the game folder untouched. Once
+// files start moving into place the commit runs to the end.
+func (r *Registry) ApplyMods(ctx context.Context) error {
+	kerbalDir, err := getKerbalDir()
+	if err != nil {
+		return fmt.Errorf("getting KSP dir: %v", err)
+	}
 
-		common.LogSuccessf("Installed %v mods", r.Queue.InstallLen())
-		return nil
+	unlock, err := lockInstance(kerbalDir)
+	if err != nil {
+		return err
 	}
-	return errors.New("install queue empty")
-}
+	defer unlock()
 
-// Install a mod
-func (r *Registry) installMod(mod *ckan.Ckan) error {
-	// open zip
-	zipReader, err := zip.OpenReader(r.GetTempDir() + mod.Download.Path)
+	// the staging folder of an unfinished apply holds the only backups
+	pending, err := ReadJournal(kerbalDir)
 	if err != nil {
-		return fmt.Errorf("opening zip file: %v", mod.Download.Path)
+		return fmt.Errorf("reading journal: %v", err)
+	}
+	if pending != nil {
+		return fmt.Errorf("the last apply was interrupted (%v), restart go-kerbal to roll it forward or back first", pending)
+	}
+
+	if removed, err := removeStaleTransactions(kerbalDir); err != nil {
+		common.LogErrorf("Error removing stale staging folders: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d stale staging folders", removed)
 	}
-	defer zipReader.Close()
 
-	// get Kerbal folder
-	cfg := config.GetConfig()
-	gameDataDir, err := filepath.Abs(cfg.Settings.KerbalDir)
+	// dependencies go first
+	mods := make([]ckan.Ckan, 0, r.Queue.InstallLen())
+	for _, mod := range r.Queue.GetDependencies() {
+		if !mod.Installed() {
+			mods = append(mods, mod)
+		}
+	}
+	for _, mod := range r.Queue.GetSelections() {
+		if !mod.Installed() {
+			mods = append(mods, mod)
+		}
+	}
+
+	plans, err := r.planInstalls(mods)
 	if err != nil {
-		return fmt.Errorf("getting KSP dir: %v", err)
+		return err
 	}
+	defer closePlans(plans)
 
-	installTo := regexp.MustCompile("(?i)" + mod.Install.InstallTo)
-	// unzip all into GameData folder
-	for _, f := range zipReader.File {
-		destination, err := r.getInstallDir(f.Name, gameDataDir, installTo)
-		if err != nil {
-			return err
+	log.Print("Checking file collisions")
+	if err := r.checkCollisions(kerbalDir, plans); err != nil {
+		return err
+	}
+
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	removals := r.Queue.GetRemovals()
+	for _, mod := range removals {
+		r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseRemoving})
+		if err := r.stageRemoval(tx, mod); err != nil {
+			r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseFailed, Err: err})
+			return fmt.Errorf("%s: %v", mod.Name, err)
 		}
+	}
 
-		err = dirfs.UnzipFile(f, destination)
+	installed := make(map[string][]database.InstalledFile, len(plans))
+	for _, plan := range plans {
+		files, err := r.stageInstall(ctx, tx, plan)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err != nil {
-			return fmt.Errorf("unzipping file to filesystem: %v", err)
+			r.report(Progress{Identifier: plan.Mod.Identifier, Name: plan.Mod.Name, Phase: PhaseFailed, Err: err})
+			return fmt.Errorf("%s: %v", plan.Mod.Name, err)
 		}
+		installed[plan.Mod.Identifier] = files
+	}
 
+	// folders are recorded before the commit creates them
+	created := make(map[string][]string, len(plans))
+	for _, plan := range plans {
+		targets := make([]string, 0, len(plan.Files))
+		for _, file := range plan.Files {
+			targets = append(targets, file.Target)
+		}
+		created[plan.Mod.Identifier] = newDirectories(kerbalDir, targets)
 	}
-	log.Printf("Installed: %v", mod.Name)
-	return nil
-}
 
-func (r *Registry) getInstallDir(file, gameDataDir string, installTo *regexp.Regexp) (string, error) {
-	if file != "" {
-		// verify file path matches GameData directory
-		if installTo.MatchString(file) {
-			// trim filepath to ensure it aligns with GameData directory
-			if !strings.HasPrefix(file, "GameData") {
-				dest := file
-				for _, char := range file {
-					dest = strings.TrimPrefix(dest, string(char))
-					if strings.HasPrefix(dest, "GameData") {
-						file = dest
-						break
-					}
-				}
-				if !strings.HasPrefix(dest, "GameData") {
-					// double check the trim worked
-					return "", fmt.Errorf("bad trim: f.Name: \"%v\" -> \"%v\", prefix: %v", file, gameDataDir, strings.HasPrefix(file, "GameData"))
-				}
-			}
-		} else {
-			// dump extras into GameData
-			// this is done for depenendencies like .dlls and merging mods
-			// might be able to do this in a safer way
-			gameDataDir = gameDataDir + "/GameData/"
+	journal := Journal{Transaction: tx}
+	for id := range removals {
+		if manifest, ok := r.Manifests[id]; ok {
+			journal.Forget = append(journal.Forget, manifest)
 		}
+	}
+	for _, plan := range plans {
+		journal.Record = append(journal.Record, newManifest(plan.Mod, kerbalDir, installed[plan.Mod.Identifier], created[plan.Mod.Identifier]))
+	}
 
-		// merge file paths
-		filePath := filepath.Join(gameDataDir, file)
-		if !strings.HasPrefix(filePath, filepath.Clean(gameDataDir)+string(os.PathSeparator)) {
-			return "", fmt.Errorf("invalid file path: %s", filePath)
+	// last chance to back out with nothing changed
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// nothing in the game folder changes until the journal is on disk
+	tx.prepare()
+	if err := writeJournal(journal); err != nil {
+		return fmt.Errorf("writing journal: %v", err)
+	}
+
+	common.LogCommandf("Applying %d changes", len(tx.Ops))
+	if err := tx.Commit(); err != nil {
+		if !tx.keep {
+			clearJournal(kerbalDir)
 		}
+		return err
+	}
 
-		// warn if overwriting vanilla game data
-		if strings.Contains(filePath, "GameData/Squad/") || strings.Contains(filePath, "GameData/SquadExpansion/") {
-			common.LogWarningf("Warning: attempting to overwrite KSP data: %s", filePath)
+	for _, manifest := range journal.Forget {
+		if err := r.forgetInstall(manifest); err != nil {
+			common.LogErrorf("%s: %v", manifest.Identifier, err)
 		}
+	}
+	for _, manifest := range journal.Record {
+		if err := r.recordInstall(manifest); err != nil {
+			common.LogErrorf("%s: %v", manifest.Identifier, err)
+		}
+		log.Printf("Installed: %v (%d files)", manifest.Identifier, len(manifest.Files))
+	}
+	clearJournal(kerbalDir)
 
-		return filePath, nil
+	for _, mod := range removals {
+		r.report(Progress{Identifier: mod.Identifier, Name: mod.Name, Phase: PhaseDone})
 	}
-	return "", errors.New("empty file string")
+	for _, plan := range plans {
+		r.report(Progress{Identifier: plan.Mod.Identifier, Name: plan.Mod.Name, Phase: PhaseDone})
+	}
+
+	common.LogSuccessf("Removed %d and installed %d mods", len(removals), len(plans))
+	return nil
 }
 
-// Gather list of mods and dependencies for download
-func (r *Registry) CheckDependencies(mod ckan.Ckan) (map[string]ckan.Ckan, error) {
-	mods := make(map[string]ckan.Ckan)
-	count := 0
-	if mod.Identifier == "" {
-		return mods, errors.New("empty mod provided")
+// Extract every file of a mod into the transaction's staging tree
+func (r *Registry) stageInstall(ctx context.Context, tx *Transaction, plan installPlan) ([]database.InstalledFile, error) {
+	files := make([]database.InstalledFile, 0, len(plan.Files))
+	for i, file := range plan.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		r.reportBytes(Progress{
+			Identifier: plan.Mod.Identifier,
+			Name:       plan.Mod.Name,
+			Phase:      PhaseExtracting,
+			Done:       int64(i),
+			Total:      int64(len(plan.Files)),
+			File:       file.Target,
+		})
+		if _, err := getInstallPath(tx.KerbalDir, file.Target); err != nil {
+			return nil, err
+		}
+
+		staged, err := tx.StageFile(file.Target, file.Entry)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, staged)
 	}
+	return files, nil
+}
 
-	if !mod.IsCompatible {
-		common.LogWarningf("Warning: %v is not compatible with your current configuration", mod.Name)
+// Join a target path onto the KSP directory, refusing to leave it
+func getInstallPath(kerbalDir, target string) (string, error) {
+	if target == "" {
+		return "", errors.New("empty file string")
 	}
 
-	if len(mod.ModDepends) > 0 {
-		for i := range mod.ModDepends {
-			dependent := r.UnsortedModMap[mod.ModDepends[i]]
-			if dependent.Identifier != "" {
-				if mods[dependent.Identifier].Identifier == "" {
-					if !dependent.IsCompatible {
-						common.LogWarningf("Warning: %v depends on %s (incompatible with current configuration)", mod.Name, dependent.Name)
-					}
-					mods[dependent.Identifier] = dependent
-					count++
-				}
-			} else {
-				return mods, fmt.Errorf("could not find dependency: %v for %v", mod.ModDepends[i], mod.Name)
-			}
-		}
+	filePath := filepath.Join(kerbalDir, filepath.FromSlash(target))
+	if !strings.HasPrefix(filePath, filepath.Clean(kerbalDir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid file path: %s", filePath)
 	}
-	if count > 0 {
-		log.Printf("Found %d dependencies", count)
+
+	// warn if overwriting vanilla game data
+	if strings.Contains(filePath, "GameData/Squad/") || strings.Contains(filePath, "GameData/SquadExpansion/") {
+		common.LogWarningf("Warning: attempting to overwrite KSP data: %s", filePath)
 	}
 
-	return mods, nil
+	return filePath, nil
 }
 
 // check for conflicts
+//
+// Conflicts match real identifiers and anything provided under them, within
+// their version bounds, the same as the resolver
 func (r *Registry) checkConflicts(mods []ckan.Ckan) error {
 	// find conflicts for each queued mod
 	for i := range mods {
-		if len(mods[i].ModConflicts) > 0 {
-			for j, conflict := range mods[i].ModConflicts {
-				// check conflicts with installed mods
-				if r.InstalledModList[conflict].Identifier != "" {
-					return fmt.Errorf("%v requires %v which conflicts with installed %v", mods[i].Name, mods[j].Name, conflict)
+		for _, conflict := range mods[i].ModConflicts {
+			// check conflicts with installed mods
+			for id, installed := range r.InstalledModList {
+				if id != mods[i].Identifier && conflict.MatchedBy(installed) && !r.Queue.CheckRemovals(id) {
+					return fmt.Errorf("%v conflicts with installed %v", mods[i].Name, installed.Name)
+				}
+			}
+
+			// check conflicts with queued mods
+			for j := range mods {
+				if i != j && conflict.MatchedBy(mods[j]) {
+					return fmt.Errorf("%v conflicts with queued %v", mods[i].Name, mods[j].Name)
 				}
+			}
+		}
+	}
 
-				// check conflicts with queued mods
-				for j := range mods {
-					if mods[j].Identifier == conflict {
-						return fmt.Errorf("%v requires %v which conflicts with queued %v", mods[i].Name, mods[j].Name, conflict)
-					}
+	// check installed mods declaring conflicts with queued mods
+	for id, installed := range r.InstalledModList {
+		if r.Queue.CheckRemovals(id) {
+			continue
+		}
+		for _, conflict := range installed.ModConflicts {
+			for i := range mods {
+				if mods[i].Identifier != id && conflict.MatchedBy(mods[i]) {
+					return fmt.Errorf("installed %v conflicts with queued %v", installed.Name, mods[i].Name)
 				}
 			}
 		}
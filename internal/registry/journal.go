@@ -0,0 +1,170 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jedwards1230/go-kerbal/internal/database"
+)
+
+// Journal records an apply in progress so it can be finished or undone
+// after a crash
+//
+// It is written into the work folder of the KSP instance before the game
+// folder changes and removed once the change and its install records are
+// complete.
+type Journal struct {
+	Transaction *Transaction
+	Forget      []database.InstalledMod
+	Record      []database.InstalledMod
+}
+
+func journalPath(kerbalDir string) string {
+	return filepath.Join(kerbalDir, workDir, "journal.json")
+}
+
+// Write the journal atomically
+func writeJournal(j Journal) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	p := journalPath(j.Transaction.KerbalDir)
+	tmp := p + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func clearJournal(kerbalDir string) {
+	if err := os.Remove(journalPath(kerbalDir)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing journal: %v", err)
+	}
+	// only removed once no transaction is using it
+	os.Remove(filepath.Join(kerbalDir, workDir))
+}
+
+// Load an unfinished journal left by an interrupted apply on the instance
+//
+// Returns nil if the last apply finished.
+func ReadJournal(kerbalDir string) (*Journal, error) {
+	data, err := os.ReadFile(journalPath(kerbalDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("reading journal: %v", err)
+	}
+	if j.Transaction == nil {
+		return nil, errors.New("journal has no transaction")
+	}
+	j.Transaction.reconcile()
+	return &j, nil
+}
+
+// Clean up after an apply killed while staging, before it wrote a journal
+//
+// Returns how many staging folders were removed. Fails with a *LockedError
+// while another process is changing the instance. The lock is only taken
+// if there are staging folders to look at.
+func RemoveStaleStaging(kerbalDir string) (int, error) {
+	dirs, err := filepath.Glob(filepath.Join(kerbalDir, workDir, "tx-*"))
+	if err != nil || len(dirs) == 0 {
+		return 0, err
+	}
+
+	unlock, err := lockInstance(kerbalDir)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	return removeStaleTransactions(kerbalDir)
+}
+
+// Summary of the interrupted change
+func (j Journal) String() string {
+	done := 0
+	for _, op := range j.Transaction.Ops {
+		if op.Done {
+			done++
+		}
+	}
+	return fmt.Sprintf("%d of %d file changes applied in %v, removing %d and installing %d mods",
+		done, len(j.Transaction.Ops), j.Transaction.KerbalDir, len(j.Forget), len(j.Record))
+}
+
+// Finish the interrupted change and write its install records
+func (j Journal) RollForward(db *database.CkanDB) error {
+	tx := j.Transaction
+	unlock, err := lockInstance(tx.KerbalDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for i := range tx.Ops {
+		if tx.Ops[i].Done {
+			continue
+		}
+		if err := tx.apply(i); err != nil {
+			return fmt.Errorf("rolling forward: %v", err)
+		}
+	}
+	tx.prune()
+
+	for _, manifest := range j.Forget {
+		if err := db.DeleteInstalled(manifest.KerbalDir, manifest.Identifier); err != nil {
+			return err
+		}
+	}
+	for _, manifest := range j.Record {
+		if err := db.SaveInstalled(manifest); err != nil {
+			return err
+		}
+	}
+
+	tx.Close()
+	clearJournal(tx.KerbalDir)
+	log.Printf("Rolled forward %d file changes", len(tx.Ops))
+	return nil
+}
+
+// Undo the interrupted change, restoring the game folder
+func (j Journal) RollBack() error {
+	tx := j.Transaction
+	unlock, err := lockInstance(tx.KerbalDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := tx.Rollback(); err != nil {
+		return err
+	}
+	tx.Close()
+	clearJournal(tx.KerbalDir)
+	return nil
+}
@@ -0,0 +1,201 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/jedwards1230/go-kerbal/internal/database"
+	"github.com/jedwards1230/go-kerbal/internal/queue"
+	"github.com/spf13/viper"
+)
+
+// Start a commit and stop after the first change, as a crash would
+func interruptedJournal(t *testing.T) (Journal, string) {
+	kerbalDir := t.TempDir()
+	old := filepath.Join(kerbalDir, "GameData", "Old.cfg")
+	os.MkdirAll(filepath.Dir(old), os.ModePerm)
+	os.WriteFile(old, []byte("old"), 0644)
+
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Delete("GameData/Old.cfg")
+	files := make([]database.InstalledFile, 0)
+	file, err := tx.StageFile("GameData/New/New.cfg", testEntry(t, "New.cfg", "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, file)
+
+	journal := Journal{
+		Transaction: tx,
+		Record:      []database.InstalledMod{{Identifier: "New", KerbalDir: kerbalDir, Files: files}},
+	}
+	tx.prepare()
+	if err := writeJournal(journal); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clearJournal(kerbalDir) })
+
+	if err := tx.apply(0); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := ReadJournal(kerbalDir)
+	if err != nil || loaded == nil {
+		t.Fatalf("could not read journal: %v", err)
+	}
+	return *loaded, kerbalDir
+}
+
+func TestJournalRollBack(t *testing.T) {
+	journal, kerbalDir := interruptedJournal(t)
+	if !journal.Transaction.Ops[0].Done || journal.Transaction.Ops[1].Done {
+		t.Fatalf("journal progress not recovered: %+v", journal.Transaction.Ops)
+	}
+
+	if err := journal.RollBack(); err != nil {
+		t.Fatalf("could not roll back: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(kerbalDir, "GameData", "Old.cfg")); got != "old" {
+		t.Errorf("deleted file not restored: %v", got)
+	}
+	if j, _ := ReadJournal(kerbalDir); j != nil {
+		t.Error("journal left after roll back")
+	}
+}
+
+func TestJournalPerInstance(t *testing.T) {
+	_, kerbalDir := interruptedJournal(t)
+	if _, err := os.Stat(filepath.Join(kerbalDir, workDir, "journal.json")); err != nil {
+		t.Errorf("journal not kept in the instance: %v", err)
+	}
+
+	other := t.TempDir()
+	if j, err := ReadJournal(other); err != nil || j != nil {
+		t.Errorf("another instance sees the journal: %v, %v", j, err)
+	}
+}
+
+func TestApplyModsPendingJournal(t *testing.T) {
+	journal, kerbalDir := interruptedJournal(t)
+	oldDir := viper.GetString("settings.kerbal_dir")
+	viper.Set("settings.kerbal_dir", kerbalDir)
+	t.Cleanup(func() { viper.Set("settings.kerbal_dir", oldDir) })
+
+	r := &Registry{Queue: queue.New()}
+	if err := r.ApplyMods(context.Background()); err == nil {
+		t.Fatal("expected apply to refuse while a journal is pending")
+	}
+	if _, err := os.Stat(journal.Transaction.Dir); err != nil {
+		t.Errorf("staging folder of the pending journal removed: %v", err)
+	}
+	if j, _ := ReadJournal(kerbalDir); j == nil {
+		t.Error("pending journal replaced")
+	}
+}
+
+func TestJournalRollForward(t *testing.T) {
+	journal, kerbalDir := interruptedJournal(t)
+
+	db := database.GetDB(":memory:")
+	defer db.Close()
+	if err := journal.RollForward(db); err != nil {
+		t.Fatalf("could not roll forward: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(kerbalDir, "GameData", "New", "New.cfg")); got != "new" {
+		t.Errorf("staged file not installed: %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData", "Old.cfg")); !os.IsNotExist(err) {
+		t.Error("deleted file still present")
+	}
+
+	installed, err := db.GetInstalled(kerbalDir)
+	if err != nil || len(installed["New"].Files) != 1 {
+		t.Errorf("install record not written: %v %v", installed, err)
+	}
+}
+
+// Set to a KSP dir to run the test binary as an apply stuck mid-staging
+const stagingHelperEnv = "GO_KERBAL_STAGING_HELPER"
+
+// Lock the instance and stage a file, then wait to be killed
+func runStagingHelper(kerbalDir string) {
+	if _, err := lockInstance(kerbalDir); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	staged := filepath.Join(tx.Dir, "stage", "0", "GameData", "Big.dll")
+	os.MkdirAll(filepath.Dir(staged), os.ModePerm)
+	if err := os.WriteFile(staged, []byte("big"), 0644); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("staged")
+	select {}
+}
+
+func TestRecoverKilledStaging(t *testing.T) {
+	kerbalDir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), stagingHelperEnv+"="+kerbalDir)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	if line, err := bufio.NewReader(out).ReadString('\n'); err != nil || line != "staged\n" {
+		t.Fatalf("helper did not stage: %q %v", line, err)
+	}
+
+	// the running apply keeps its staging tree
+	var locked *LockedError
+	if _, err := RemoveStaleStaging(kerbalDir); !errors.As(err, &locked) {
+		t.Fatalf("expected the instance to be locked, got %v", err)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	left, _ := filepath.Glob(filepath.Join(kerbalDir, workDir, "tx-*"))
+	if len(left) != 1 {
+		t.Fatalf("expected the killed apply's staging folder, got %v", left)
+	}
+	removed, err := RemoveStaleStaging(kerbalDir)
+	if err != nil {
+		t.Fatalf("could not recover: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d staging folders, want 1", removed)
+	}
+	if _, err := os.Stat(left[0]); !os.IsNotExist(err) {
+		t.Error("staging folder of the killed apply left behind")
+	}
+}
+
+func TestRemoveStaleStagingNothingStaged(t *testing.T) {
+	kerbalDir := t.TempDir()
+
+	// with nothing to clean up a held lock is left alone
+	writeLock(t, filepath.Join(kerbalDir, lockFile), os.Getppid())
+	removed, err := RemoveStaleStaging(kerbalDir)
+	if err != nil || removed != 0 {
+		t.Errorf("got %d, %v, want nothing removed", removed, err)
+	}
+}
@@ -0,0 +1,180 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Lock file go-kerbal holds in a KSP directory while changing it
+const lockFile = "go-kerbal.lock"
+
+// Lock file the CKAN client holds while its registry is open
+var ckanLockFile = filepath.Join("CKAN", "registry.locked")
+
+// How long an unreadable lock is still trusted, in case its owner crashed
+// before writing a pid
+const lockGrace = 30 * time.Second
+
+// LockedError reports a KSP instance in use by another process
+type LockedError struct {
+	Owner string
+	PID   int
+	Path  string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("instance is locked by %v (pid %d): %v", e.Owner, e.PID, e.Path)
+}
+
+// Check if another process holds a lock on the KSP instance
+//
+// Returns a *LockedError if so. Locks left by processes that no longer
+// run are ignored.
+func CheckLock(kerbalDir string) error {
+	ckanLock := filepath.Join(kerbalDir, ckanLockFile)
+	if pid, err := readLockPID(ckanLock); err == nil && processAlive(pid) {
+		return &LockedError{Owner: "CKAN", PID: pid, Path: ckanLock}
+	}
+
+	ownLock := filepath.Join(kerbalDir, lockFile)
+	if pid, held := lockHeld(ownLock); held && pid != os.Getpid() {
+		return &LockedError{Owner: "go-kerbal", PID: pid, Path: ownLock}
+	}
+	return nil
+}
+
+// Take an exclusive lock on the KSP instance
+//
+// The returned function releases it.
+func lockInstance(kerbalDir string) (func(), error) {
+	if err := CheckLock(kerbalDir); err != nil {
+		return nil, err
+	}
+
+	lockPath := filepath.Join(kerbalDir, lockFile)
+	for attempt := 0; attempt < 2; attempt++ {
+		err := createLock(lockPath)
+		if err == nil {
+			return func() {
+				if err := os.Remove(lockPath); err != nil {
+					log.Printf("Error releasing lock: %v", err)
+				}
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("creating lock: %v", err)
+		}
+
+		// another process may have taken it since the check
+		pid, held := lockHeld(lockPath)
+		if held {
+			return nil, &LockedError{Owner: "go-kerbal", PID: pid, Path: lockPath}
+		}
+		log.Printf("Removing stale lock from pid %d", pid)
+		if err := removeStaleLock(lockPath, pid); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("could not lock %v", kerbalDir)
+}
+
+// Remove a lock found stale without touching one taken since
+//
+// Another process may have replaced the stale lock with its own after it
+// was checked. The lock is moved aside in one step and checked again, and
+// put back if it turns out to be held.
+func removeStaleLock(lockPath string, stalePID int) error {
+	aside := fmt.Sprintf("%s.stale-%d", lockPath, os.Getpid())
+	if err := os.Rename(lockPath, aside); err != nil {
+		if os.IsNotExist(err) {
+			// someone else cleared it first
+			return nil
+		}
+		return fmt.Errorf("removing stale lock: %v", err)
+	}
+	defer os.Remove(aside)
+
+	pid, held := lockHeld(aside)
+	if !held && pid == stalePID {
+		return nil
+	}
+	if err := os.Link(aside, lockPath); err != nil {
+		log.Printf("Error restoring lock of pid %d: %v", pid, err)
+	}
+	return &LockedError{Owner: "go-kerbal", PID: pid, Path: lockPath}
+}
+
+// Create the lock file already holding our pid
+//
+// The pid is written to a temp file that is then linked into place, so
+// the lock never exists empty. Fails with os.ErrExist if it is taken.
+func createLock(lockPath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(lockPath), "."+lockFile+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strconv.Itoa(os.Getpid()))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing lock: %v", err)
+	}
+	return os.Link(tmp.Name(), lockPath)
+}
+
+// Check if a go-kerbal lock file belongs to a running process
+//
+// A lock without a readable pid counts as held until it is older than
+// lockGrace.
+func lockHeld(lockPath string) (int, bool) {
+	pid, err := readLockPID(lockPath)
+	if err == nil {
+		return pid, processAlive(pid)
+	}
+	info, statErr := os.Stat(lockPath)
+	if statErr != nil {
+		return 0, false
+	}
+	return 0, time.Since(info.ModTime()) < lockGrace
+}
+
+func readLockPID(lockPath string) (int, error) {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// Returns true if a process with the pid is running
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	if pid == os.Getpid() {
+		return true
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// FindProcess only succeeds for running processes on Windows
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
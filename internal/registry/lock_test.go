@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func writeLock(t *testing.T, p string, pid int) {
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(strconv.Itoa(pid)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockInstance(t *testing.T) {
+	kerbalDir := t.TempDir()
+
+	// a lock left by a process that is gone is taken over
+	writeLock(t, filepath.Join(kerbalDir, lockFile), 1<<30)
+	unlock, err := lockInstance(kerbalDir)
+	if err != nil {
+		t.Fatalf("stale lock not replaced: %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(filepath.Join(kerbalDir, lockFile)); !os.IsNotExist(err) {
+		t.Error("lock not released")
+	}
+
+	// the parent process is running, so its lock holds
+	writeLock(t, filepath.Join(kerbalDir, lockFile), os.Getppid())
+	var locked *LockedError
+	if _, err := lockInstance(kerbalDir); !errors.As(err, &locked) || locked.Owner != "go-kerbal" {
+		t.Errorf("expected lock held by go-kerbal, got %v", err)
+	}
+}
+
+func TestLockInstanceCkan(t *testing.T) {
+	kerbalDir := t.TempDir()
+	writeLock(t, filepath.Join(kerbalDir, ckanLockFile), os.Getppid())
+
+	var locked *LockedError
+	if _, err := lockInstance(kerbalDir); !errors.As(err, &locked) || locked.Owner != "CKAN" {
+		t.Errorf("expected lock held by CKAN, got %v", err)
+	}
+}
+
+func TestLockInstanceUnreadable(t *testing.T) {
+	kerbalDir := t.TempDir()
+	lockPath := filepath.Join(kerbalDir, lockFile)
+
+	// its owner may not have written the pid yet
+	if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var locked *LockedError
+	if _, err := lockInstance(kerbalDir); !errors.As(err, &locked) {
+		t.Fatalf("expected fresh empty lock to hold, got %v", err)
+	}
+
+	// but not forever
+	old := time.Now().Add(-2 * lockGrace)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lockInstance(kerbalDir)
+	if err != nil {
+		t.Fatalf("old empty lock not replaced: %v", err)
+	}
+	defer unlock()
+
+	if pid, err := readLockPID(lockPath); err != nil || pid != os.Getpid() {
+		t.Errorf("lock holds %v, %v, want %d", pid, err, os.Getpid())
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(kerbalDir, "."+lockFile+"-*")); len(leftover) > 0 {
+		t.Errorf("temp lock files left behind: %v", leftover)
+	}
+}
+
+func TestRemoveStaleLockReplaced(t *testing.T) {
+	kerbalDir := t.TempDir()
+	lockPath := filepath.Join(kerbalDir, lockFile)
+
+	// seen stale, but another process took the lock before it was removed
+	writeLock(t, lockPath, os.Getppid())
+	var locked *LockedError
+	if err := removeStaleLock(lockPath, 1<<30); !errors.As(err, &locked) || locked.PID != os.Getppid() {
+		t.Fatalf("expected the new lock to hold, got %v", err)
+	}
+	if pid, err := readLockPID(lockPath); err != nil || pid != os.Getppid() {
+		t.Errorf("new lock not put back: %v, %v", pid, err)
+	}
+
+	writeLock(t, lockPath, 1<<30)
+	if err := removeStaleLock(lockPath, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := filepath.Glob(lockPath + "*"); len(left) > 0 {
+		t.Errorf("stale lock left behind: %v", left)
+	}
+}
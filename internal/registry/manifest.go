@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/common"
+	"github.com/jedwards1230/go-kerbal/internal/config"
+	"github.com/jedwards1230/go-kerbal/internal/database"
+)
+
+// Absolute path of the configured KSP instance
+func getKerbalDir() (string, error) {
+	cfg := config.GetConfig()
+	if cfg.Settings.KerbalDir == "" {
+		return "", errors.New("KSP dir not set")
+	}
+	return filepath.Abs(cfg.Settings.KerbalDir)
+}
+
+// Load install manifests for the configured KSP instance
+func (r *Registry) loadManifests() {
+	r.Manifests = make(map[string]database.InstalledMod)
+
+	kerbalDir, err := getKerbalDir()
+	if err != nil {
+		return
+	}
+	manifests, err := r.DB.GetInstalled(kerbalDir)
+	if err != nil {
+		common.LogErrorf("Error loading install records: %v", err)
+		return
+	}
+	r.Manifests = manifests
+}
+
+// Folders a set of targets will create, in the order they are created
+func newDirectories(kerbalDir string, targets []string) []string {
+	seen := make(map[string]bool)
+	dirs := make([]string, 0)
+	for _, target := range targets {
+		for dir := path.Dir(target); dir != "." && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			if _, err := os.Stat(filepath.Join(kerbalDir, filepath.FromSlash(dir))); os.IsNotExist(err) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") < strings.Count(dirs[j], "/")
+	})
+	return dirs
+}
+
+func newManifest(mod ckan.Ckan, kerbalDir string, files []database.InstalledFile, dirs []string) database.InstalledMod {
+	return database.InstalledMod{
+		Identifier:  mod.Identifier,
+		Version:     mod.Versions.Mod.String(),
+		KerbalDir:   kerbalDir,
+		Files:       files,
+		Directories: dirs,
+	}
+}
+
+// Store the manifest of a freshly installed mod
+func (r *Registry) recordInstall(manifest database.InstalledMod) error {
+	if err := r.DB.SaveInstalled(manifest); err != nil {
+		return fmt.Errorf("saving install record: %v", err)
+	}
+	if r.Manifests == nil {
+		r.Manifests = make(map[string]database.InstalledMod)
+	}
+	r.Manifests[manifest.Identifier] = manifest
+	return nil
+}
+
+// Queue deletion of exactly the files a mod installed
+//
+// Files also listed by another mod are kept. Folders are only removed once
+// empty.
+func (r *Registry) stageManifestRemoval(tx *Transaction, manifest database.InstalledMod) {
+	for _, file := range manifest.Files {
+		if owner := r.fileOwner(file.Path, manifest.Identifier); owner != "" {
+			log.Printf("Keeping %v, also installed by %v", file.Path, owner)
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(manifest.KerbalDir, filepath.FromSlash(file.Path))); err != nil {
+			continue
+		}
+		tx.Delete(file.Path)
+	}
+	tx.PruneIfEmpty(manifest.Directories...)
+}
+
+// Forget the manifest of a removed mod
+func (r *Registry) forgetInstall(manifest database.InstalledMod) error {
+	if err := r.DB.DeleteInstalled(manifest.KerbalDir, manifest.Identifier); err != nil {
+		return fmt.Errorf("deleting install record: %v", err)
+	}
+	delete(r.Manifests, manifest.Identifier)
+	return nil
+}
+
+// Find another mod whose manifest lists the file
+//
+// Mods queued for removal no longer own anything.
+func (r *Registry) fileOwner(filePath, except string) string {
+	for id, manifest := range r.Manifests {
+		if id != except && !r.Queue.CheckRemovals(id) && manifest.OwnsFile(filePath) {
+			return id
+		}
+	}
+	return ""
+}
+
+// Find another mod whose manifest lists dir or anything inside it
+//
+// Mods queued for removal no longer own anything.
+func (r *Registry) dirOwner(dir, except string) string {
+	for id, manifest := range r.Manifests {
+		if id != except && !r.Queue.CheckRemovals(id) && manifest.OwnsUnder(dir) {
+			return id
+		}
+	}
+	return ""
+}
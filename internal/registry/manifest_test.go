@@ -0,0 +1,181 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/database"
+	"github.com/jedwards1230/go-kerbal/internal/queue"
+)
+
+func writeKerbalFiles(t *testing.T, kerbalDir string, names ...string) {
+	for _, name := range names {
+		p := filepath.Join(kerbalDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRemoveByManifest(t *testing.T) {
+	kerbalDir := t.TempDir()
+	writeKerbalFiles(t, kerbalDir, "GameData/Foo/Foo.dll", "GameData/Shared/Lib.dll", "GameData/Foo/User.cfg")
+
+	foo := database.InstalledMod{
+		Identifier:  "Foo",
+		KerbalDir:   kerbalDir,
+		Files:       []database.InstalledFile{{Path: "GameData/Foo/Foo.dll"}, {Path: "GameData/Shared/Lib.dll"}},
+		Directories: []string{"GameData/Foo", "GameData/Shared"},
+	}
+	bar := database.InstalledMod{
+		Identifier: "Bar",
+		KerbalDir:  kerbalDir,
+		Files:      []database.InstalledFile{{Path: "GameData/Shared/Lib.dll"}},
+	}
+
+	r := &Registry{
+		DB:        database.GetDB(":memory:"),
+		Manifests: map[string]database.InstalledMod{"Foo": foo, "Bar": bar},
+		Queue:     queue.New(),
+	}
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	r.stageManifestRemoval(tx, foo)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("could not remove: %v", err)
+	}
+	if err := r.forgetInstall(foo); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData/Foo/Foo.dll")); !os.IsNotExist(err) {
+		t.Error("owned file was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData/Shared/Lib.dll")); err != nil {
+		t.Error("file shared with another mod was removed")
+	}
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData/Foo/User.cfg")); err != nil {
+		t.Error("untracked file was removed")
+	}
+	if _, ok := r.Manifests["Foo"]; ok {
+		t.Error("manifest still recorded")
+	}
+}
+
+func TestRemoveByFolderName(t *testing.T) {
+	kerbalDir := t.TempDir()
+	writeKerbalFiles(t, kerbalDir, "GameData/Legacy/Legacy.dll", "GameData/Shared/Lib.dll", "GameData/Shared/Bar/Bar.dll")
+
+	// installed before manifests were kept, so only folder names are known
+	legacy := testMod("Legacy", "1.0")
+	legacy.Install.Stanzas = []ckan.InstallStanza{
+		{Find: "Legacy", InstallTo: "GameData"},
+		{Find: "Shared", InstallTo: "GameData"},
+	}
+	bar := database.InstalledMod{
+		Identifier: "Bar",
+		KerbalDir:  kerbalDir,
+		Files:      []database.InstalledFile{{Path: "GameData/Shared/Bar/Bar.dll"}},
+	}
+
+	r := &Registry{
+		DB:        database.GetDB(":memory:"),
+		Manifests: map[string]database.InstalledMod{"Bar": bar},
+		Queue:     queue.New(),
+	}
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	if err := r.stageRemoval(tx, legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("could not remove: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData/Legacy")); !os.IsNotExist(err) {
+		t.Error("legacy folder was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData/Shared/Bar/Bar.dll")); err != nil {
+		t.Error("folder holding another mod's files was removed")
+	}
+}
+
+func TestRemoveByFolderNameRegexp(t *testing.T) {
+	kerbalDir := t.TempDir()
+	writeKerbalFiles(t, kerbalDir, "GameData/KopernicusExpansion/Expansion.dll")
+
+	kopernicus := testMod("Kopernicus", "1.0")
+	kopernicus.Install.Stanzas = []ckan.InstallStanza{{FindRegex: "Kopernicus", InstallTo: "GameData"}}
+
+	r := &Registry{Queue: queue.New()}
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	// only a full folder name match is trusted
+	if err := r.stageRemoval(tx, kopernicus); err == nil {
+		t.Error("expected no files found for a partial folder name match")
+	}
+
+	writeKerbalFiles(t, kerbalDir, "GameData/Kopernicus/Kopernicus.dll")
+	if err := r.stageRemoval(tx, kopernicus); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("could not remove: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData/Kopernicus")); !os.IsNotExist(err) {
+		t.Error("matching folder was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData/KopernicusExpansion/Expansion.dll")); err != nil {
+		t.Error("folder of another mod was removed")
+	}
+}
+
+func TestInstalledVersionMissingFromMetadata(t *testing.T) {
+	r := testRegistry(testMod("Foo", "0.9"), testMod("Foo", "2.0"), testMod("Bar", "1.0"))
+	r.Queue = queue.New()
+	r.Manifests = map[string]database.InstalledMod{
+		"Foo":  {Identifier: "Foo", Version: "1.0"},
+		"Bar":  {Identifier: "Bar", Version: "1.0"},
+		"Gone": {Identifier: "Gone", Version: "3.0"},
+	}
+	r.InstalledModList = make(map[string]ckan.Ckan)
+	for _, mods := range r.TotalModMap {
+		for i := range mods {
+			r.checkModInstalled(&mods[i], nil)
+		}
+	}
+	r.addMissingInstalls(r.TotalModMap)
+
+	for id, want := range map[string]string{"Foo": "1.0", "Bar": "1.0", "Gone": "3.0"} {
+		mod, ok := r.InstalledModList[id]
+		if !ok || !mod.Installed() || mod.Versions.Mod.String() != want {
+			t.Errorf("%v: got %+v, want installed at %v", id, mod, want)
+		}
+	}
+
+	// still removable by name
+	if err := r.AddToQueue(r.InstalledModList["Gone"]); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Queue.CheckRemovals("Gone") {
+		t.Error("Gone not queued for removal")
+	}
+}
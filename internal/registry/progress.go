@@ -0,0 +1,45 @@
+package registry
+
+// Steps a mod goes through while the queue is applied
+const (
+	PhaseQueued      = "Queued"
+	PhaseCached      = "Cached"
+	PhaseDownloading = "Downloading"
+	PhaseVerifying   = "Verifying"
+	PhaseExtracting  = "Extracting"
+	PhaseRemoving    = "Removing"
+	PhaseDone        = "Done"
+	PhaseFailed      = "Failed"
+)
+
+// Progress reports how far an apply has got with one mod
+//
+// Done and Total count bytes while downloading and files while extracting.
+// Total is 0 or less when the size is not known.
+type Progress struct {
+	Identifier string
+	Name       string
+	Phase      string
+	Done       int64
+	Total      int64
+	File       string
+	Err        error
+}
+
+// Send a change of phase, waiting for the listener if needed
+func (r *Registry) report(p Progress) {
+	if r.Progress != nil {
+		r.Progress <- p
+	}
+}
+
+// Send a transfer update, dropped if the listener is behind
+func (r *Registry) reportBytes(p Progress) {
+	if r.Progress == nil {
+		return
+	}
+	select {
+	case r.Progress <- p:
+	default:
+	}
+}
@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jedwards1230/go-kerbal/internal/cache"
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/download"
+)
+
+func TestFillCacheReportsProgress(t *testing.T) {
+	c, err := cache.New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Registry{Cache: c, Progress: make(chan Progress, 8)}
+
+	var mod ckan.Ckan
+	mod.Identifier = "Foo"
+	mod.Name = "Foo"
+	mod.Download.URL = "https://example.com/Foo.zip"
+	cacheArchive(t, c, mod, "zip")
+
+	if err := r.FillCache(context.Background(), []ckan.Ckan{mod}); err != nil {
+		t.Fatal(err)
+	}
+	close(r.Progress)
+
+	var phases []string
+	for p := range r.Progress {
+		if p.Identifier != "Foo" {
+			t.Errorf("progress for %v", p.Identifier)
+		}
+		phases = append(phases, p.Phase)
+	}
+	if strings.Join(phases, ",") != PhaseQueued+","+PhaseCached {
+		t.Errorf("got phases %v", phases)
+	}
+}
+
+func TestFillCacheCancelled(t *testing.T) {
+	c, err := cache.New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Registry{
+		Cache:      c,
+		Downloader: download.NewClient(http.DefaultClient, download.Retry{}, download.Limits{}),
+		Progress:   make(chan Progress, 8),
+	}
+
+	var mod ckan.Ckan
+	mod.Identifier = "Foo"
+	mod.Name = "Foo"
+	mod.Download.URL = "http://127.0.0.1:1/Foo.zip"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.FillCache(ctx, []ckan.Ckan{mod}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+	close(r.Progress)
+
+	for p := range r.Progress {
+		if p.Phase == PhaseFailed {
+			t.Errorf("cancelled download reported as failed: %v", p.Err)
+		}
+	}
+}
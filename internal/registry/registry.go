@@ -1,21 +1,25 @@
 package registry
 
 import (
-	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
-	"github.com/hashicorp/go-version"
 	"github.com/segmentio/encoding/json"
 
 	"github.com/jedwards1230/go-kerbal/internal"
+	"github.com/jedwards1230/go-kerbal/internal/cache"
 	"github.com/jedwards1230/go-kerbal/internal/ckan"
 	"github.com/jedwards1230/go-kerbal/internal/common"
 	"github.com/jedwards1230/go-kerbal/internal/config"
 	"github.com/jedwards1230/go-kerbal/internal/database"
 	"github.com/jedwards1230/go-kerbal/internal/dirfs"
+	"github.com/jedwards1230/go-kerbal/internal/download"
 	"github.com/jedwards1230/go-kerbal/internal/queue"
 	"github.com/tidwall/buntdb"
 )
@@ -26,12 +30,17 @@ type Registry struct {
 	UnsortedModMap   map[string]ckan.Ckan
 	SortedModMap     map[string]ckan.Ckan
 	ModMapIndex      ModIndex
+	ProvidesIndex    map[string][]string
 	InstalledModList map[string]ckan.Ckan
+	Manifests        map[string]database.InstalledMod
 	DB               *database.CkanDB
 	SortOptions      SortOptions
 	Queue            queue.Queue
+	Cache            *cache.Cache
+	Downloader       *download.Client
 
-	tmpDir string
+	// receives progress while the queue is applied, if set
+	Progress chan Progress
 }
 
 type SortOptions struct {
@@ -53,29 +62,64 @@ func New() Registry {
 
 	return Registry{
 		DB:               db,
+		Cache:            openCache(),
+		Downloader:       newDownloader(config.GetConfig()),
+		ProvidesIndex:    make(map[string][]string, 0),
 		InstalledModList: make(map[string]ckan.Ckan, 0),
+		Manifests:        make(map[string]database.InstalledMod, 0),
 		SortOptions:      sortOpts,
 		Queue:            q,
 	}
 }
 
+// Open the download cache from the config
+//
+// Falls back to a folder of its own in the temp dir if the configured
+// location is unusable.
+func openCache() *cache.Cache {
+	cfg := config.GetConfig()
+	maxSize := cfg.Settings.CacheMaxSize * 1024 * 1024
+	c, err := cache.New(cfg.Settings.CacheDir, maxSize)
+	if err != nil {
+		common.LogErrorf("Error opening download cache: %v", err)
+		fallback := filepath.Join(os.TempDir(), "go-kerbal-cache")
+		if c, err = cache.New(fallback, maxSize); err != nil {
+			common.LogErrorf("Error opening fallback download cache: %v", err)
+			c = &cache.Cache{Dir: fallback, MaxSize: maxSize}
+		}
+	}
+	return c
+}
+
+// Download client limited by the config
+func newDownloader(cfg config.Config) *download.Client {
+	retry := download.Retry{
+		Attempts: cfg.Settings.DownloadRetries,
+		Backoff:  time.Duration(cfg.Settings.DownloadBackoff) * time.Millisecond,
+	}
+	limits := download.Limits{
+		Parallel:    cfg.Settings.MaxDownloads,
+		PerHost:     cfg.Settings.MaxHostDownloads,
+		BytesPerSec: cfg.Settings.DownloadRateLimit,
+	}
+	return download.NewClient(http.DefaultClient, retry, limits)
+}
+
 func (r *Registry) SortModList() error {
 	common.LogCommandf("Sorting mods. Order: %s by %s", r.SortOptions.SortOrder, r.SortOptions.SortTag)
 	cfg := config.GetConfig()
 
-	var modMap map[string]ckan.Ckan
-	modMap, err := getLatestVersionMap(r.TotalModMap)
-	if err != nil {
-		return err
-	}
+	// compatibility follows the current config, not the one at import
+	versions := gameVersions(cfg)
+	r.updateCompatibility(versions)
+
+	modMap := getLatestVersionMap(r.TotalModMap)
 
 	r.UnsortedModMap = modMap
+	r.buildProvidesIndex()
 
 	if cfg.Settings.HideIncompatibleMods {
-		modMap, err = getLatestVersionMap(getCompatibleModMap(r.TotalModMap))
-		if err != nil {
-			return err
-		}
+		modMap = getLatestVersionMap(getCompatibleModMap(r.TotalModMap, versions))
 	}
 
 	r.buildModIndex(modMap)
@@ -89,23 +133,42 @@ func (r *Registry) SortModList() error {
 func (r *Registry) GetEntireModList() map[string][]ckan.Ckan {
 	log.Println("Gathering mod list from database")
 
+	r.InstalledModList = make(map[string]ckan.Ckan, 0)
+	r.loadManifests()
 	installedMap, err := dirfs.CheckInstalledMods()
 	if err != nil {
 		common.LogErrorf("Error checking installed mods: %v", err)
 	}
 
-	var mod ckan.Ckan
+	// compatibility is never stored, so evaluate it against the active game
+	cfg := config.GetConfig()
+	versions := gameVersions(cfg)
+	rankOf := repoRanks(cfg)
+
 	newMap := make(map[string][]ckan.Ckan)
+	// rank of the repo each identifier is taken from
+	sources := make(map[string]repoRank)
 	total := 0
+	overridden := 0
 	err = r.DB.View(func(tx *buntdb.Tx) error {
-		tx.Ascend("", func(_, value string) bool {
+		tx.AscendKeys("mod:*", func(_, value string) bool {
+			var mod ckan.Ckan
 			err := json.Unmarshal([]byte(value), &mod)
 			if err != nil {
 				common.LogErrorf("Error loading into Ckan struct: %v", err)
 			}
 
-			// check if mod is installed
-			r.checkModInstalled(&mod, installedMap)
+			// a higher ranked repo replaces every version of the identifier
+			rank := rankOf(mod.SourceRepo)
+			if best, ok := sources[mod.Identifier]; ok && rank != best {
+				if best.beats(rank) {
+					overridden++
+					return true
+				}
+				overridden += len(newMap[mod.Identifier])
+				newMap[mod.Identifier] = nil
+			}
+			sources[mod.Identifier] = rank
 
 			// add to list
 			newMap[mod.Identifier] = append(newMap[mod.Identifier], mod)
@@ -118,6 +181,19 @@ func (r *Registry) GetEntireModList() map[string][]ckan.Ckan {
 		log.Fatalf("Error viewing db: %v", err)
 	}
 
+	for _, mods := range newMap {
+		for i := range mods {
+			mods[i].IsCompatible = mods[i].CompatibleWith(versions...)
+
+			// check if mod is installed
+			r.checkModInstalled(&mods[i], installedMap)
+		}
+	}
+	r.addMissingInstalls(newMap)
+
+	if overridden > 0 {
+		log.Printf("Skipped %d mod files overridden by higher ranked repos", overridden)
+	}
 	common.LogSuccessf("Loaded %v mod files from database", total)
 	log.Printf("Found %d mods installed", len(r.InstalledModList))
 
@@ -125,23 +201,84 @@ func (r *Registry) GetEntireModList() map[string][]ckan.Ckan {
 }
 
 func (r *Registry) checkModInstalled(mod *ckan.Ckan, installedMap map[string]bool) {
-	if len(installedMap) > 0 {
-		if installedMap[mod.Install.Find] || installedMap[mod.Install.File] {
-			mod.SetInstalled(true)
+	// recorded installs know exactly which version is in place
+	if manifest, ok := r.Manifests[mod.Identifier]; ok {
+		mod.SetInstalled(mod.Versions.Mod.String() == manifest.Version)
+		if mod.Installed() {
 			r.InstalledModList[mod.Identifier] = *mod
-		} else if mod.Install.FindRegex != "" {
-			re := regexp.MustCompile(mod.Install.FindRegex)
+		}
+		return
+	}
+
+	if len(installedMap) > 0 {
+		mod.SetInstalled(false)
+		names, patterns := gameDataNames(*mod, true)
+		for _, name := range names {
+			if installedMap[name] {
+				mod.SetInstalled(true)
+			}
+		}
+		for _, re := range patterns {
 			for k, v := range installedMap {
 				if v && re.MatchString(k) {
 					mod.SetInstalled(true)
-					r.InstalledModList[mod.Identifier] = *mod
 					break
 				}
 			}
-		} else {
-			mod.SetInstalled(false)
 		}
+		if mod.Installed() {
+			r.InstalledModList[mod.Identifier] = *mod
+		}
+	}
+}
+
+// Keep recorded installs listed when the metadata lost their version
+//
+// A higher priority repo or a delisted release can drop the exact entry. The
+// nearest available version stands in, or a bare entry if the identifier is
+// gone entirely, carrying the recorded version so the mod can still be
+// removed and counts as installed when resolving.
+func (r *Registry) addMissingInstalls(modMap map[string][]ckan.Ckan) {
+	for id, manifest := range r.Manifests {
+		if _, ok := r.InstalledModList[id]; ok {
+			continue
+		}
+		version, err := ckan.ParseVersion(manifest.Version)
+		if err != nil {
+			common.LogErrorf("Invalid version in install record of %v: %v", id, err)
+		}
+
+		mod, ok := nearestVersion(modMap[id], version)
+		if !ok {
+			mod = ckan.Ckan{Identifier: id, Name: id, SearchableName: id, IsCompatible: true}
+		}
+		log.Printf("%v %v is no longer in the metadata, keeping it installed", id, manifest.Version)
+		mod.Versions.Mod = version
+		mod.SetInstalled(true)
+		r.InstalledModList[id] = mod
+	}
+}
+
+// Newest release no later than version, or else the oldest one after it
+func nearestVersion(mods []ckan.Ckan, version ckan.Version) (ckan.Ckan, bool) {
+	var below, above *ckan.Ckan
+	for i := range mods {
+		v := mods[i].Versions.Mod
+		if !v.GreaterThan(version) {
+			if below == nil || v.GreaterThan(below.Versions.Mod) {
+				below = &mods[i]
+			}
+		} else if above == nil || v.LessThan(above.Versions.Mod) {
+			above = &mods[i]
+		}
+	}
+	switch {
+	case below != nil:
+		return *below, true
+	case above != nil:
+		return *above, true
 	}
+	return ckan.Ckan{}, false
 }
 
 func (r *Registry) BuildSearchIndex(s string) (ModIndex, error) {
@@ -177,6 +314,23 @@ func (r *Registry) BuildQueueIndex() {
 		}
 	}
 
+	// list each alternative once, in a stable order
+	keys := make([]string, 0, r.Queue.ChoiceLen())
+	for key := range r.Queue.GetChoices() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		for _, option := range r.Queue.GetChoices()[key].Options {
+			if !seen[option.Identifier] {
+				seen[option.Identifier] = true
+				idx = append(idx, Entry{option.Identifier, "choice"})
+			}
+		}
+	}
+
 	r.SetModIndex(idx)
 }
 
@@ -198,14 +352,90 @@ func (r *Registry) buildModIndex(modMap map[string]ckan.Ckan) {
 	r.SetModIndex(idx)
 }
 
-// Filter out incompatible mods
-func getCompatibleModMap(incompatibleModMap map[string][]ckan.Ckan) map[string][]ckan.Ckan {
+// Map every identifier, real or virtual, to the mods providing it
+func (r *Registry) buildProvidesIndex() {
+	idx := make(map[string][]string, len(r.TotalModMap))
+	for id, modList := range r.TotalModMap {
+		provided := map[string]bool{id: true}
+		for _, mod := range modList {
+			for _, p := range mod.Provides {
+				provided[p] = true
+			}
+		}
+		for p := range provided {
+			idx[p] = append(idx[p], id)
+		}
+	}
+	for p := range idx {
+		sort.Strings(idx[p])
+	}
+	r.ProvidesIndex = idx
+}
+
+// KSP versions mods are checked against: the installed one plus any the user accepts
+func gameVersions(cfg config.Config) []ckan.GameVersion {
+	raw := append([]string{cfg.Settings.KerbalVer}, cfg.Settings.CompatibleVersions()...)
+	return ckan.ParseGameVersions(raw)
+}
+
+// Rank of a metadata repo when several provide the same identifier
+type repoRank struct {
+	priority int
+	// position in the config, earlier repos win a tie
+	order int
+	name  string
+}
+
+// Returns true if mods from a replace those from b
+func (a repoRank) beats(b repoRank) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if a.order != b.order {
+		return a.order < b.order
+	}
+	return a.name < b.name
+}
+
+// Rank of each configured metadata repo by name
+//
+// An imported snapshot stands in for the first repo. Repos no longer in the
+// config rank last so each identifier still has exactly one owner.
+func repoRanks(cfg config.Config) func(string) repoRank {
+	ranks := make(map[string]repoRank)
+	repos, err := cfg.Settings.Repos()
+	if err != nil {
+		common.LogErrorf("Error reading metadata repos: %v", err)
+	}
+	ranks[config.SnapshotRepoName] = repoRank{name: config.SnapshotRepoName}
+	for i, repo := range repos {
+		ranks[repo.Name] = repoRank{priority: repo.Priority, order: i + 1, name: repo.Name}
+	}
+	return func(name string) repoRank {
+		if rank, ok := ranks[name]; ok {
+			return rank
+		}
+		return repoRank{order: len(repos) + 1, name: name}
+	}
+}
+
+// Re-evaluate compatibility of every loaded mod
+func (r *Registry) updateCompatibility(versions []ckan.GameVersion) {
+	for _, modList := range r.TotalModMap {
+		for i := range modList {
+			modList[i].IsCompatible = modList[i].CompatibleWith(versions...)
+		}
+	}
+}
+
+// Filter out mods incompatible with the given KSP versions
+func getCompatibleModMap(incompatibleModMap map[string][]ckan.Ckan, versions []ckan.GameVersion) map[string][]ckan.Ckan {
 	countGood := 0
 	countBad := 0
 	compatibleModMap := make(map[string][]ckan.Ckan, len(incompatibleModMap))
 	for id, modList := range incompatibleModMap {
 		for i := range modList {
-			if modList[i].IsCompatible {
+			if modList[i].CompatibleWith(versions...) {
 				countGood += 1
 				compatibleModMap[id] = append(compatibleModMap[id], modList[i])
 			} else {
@@ -219,52 +449,20 @@ func getCompatibleModMap(incompatibleModMap map[string][]ckan.Ckan) map[string][
 }
 
 // Filters list by unique identifiers to ensure duplicate mods are not displayed
-func getLatestVersionMap(modMapBuckets map[string][]ckan.Ckan) (map[string]ckan.Ckan, error) {
+func getLatestVersionMap(modMapBuckets map[string][]ckan.Ckan) map[string]ckan.Ckan {
 	modMap := make(map[string]ckan.Ckan)
-	countGood := 0
-	countBad := 0
 	for id, modList := range modMapBuckets {
 		for _, mod := range modList {
-			// convert to proper version type for comparison
-			foundVersion, err := version.NewVersion(mod.Versions.Mod)
-			if err != nil {
-				return modMap, fmt.Errorf("error creating version: %v", err)
-			}
-
-			// check if mod is stored already
-			if modMap[id].Identifier != "" {
-				// convert to proper version type for comparison
-				storedVersion, err := version.NewVersion(modMap[id].Versions.Mod)
-				if err != nil {
-					return modMap, fmt.Errorf("error creating version: %v", err)
-				}
-
-				// compare versions and store most recent
-				if foundVersion.GreaterThan(storedVersion) {
-					// replace old mod
-					modMap[id] = mod
-				}
-				countBad += 1
-			} else {
-				// store mod if slot is empty
+			// compare versions and store most recent
+			stored, ok := modMap[id]
+			if !ok || mod.Versions.Mod.GreaterThan(stored.Versions.Mod) {
 				modMap[id] = mod
-				countGood += 1
 			}
 		}
 	}
-
-	//log.Printf("Total filtered by identifier: Unique: %d | Extra: %d", countGood, countBad)
-	return modMap, nil
+	return modMap
 }
 
 func (r *Registry) SetModIndex(modMap ModIndex) {
 	r.ModMapIndex = modMap
 }
-
-func (r *Registry) GetTempDir() string {
-	return r.tmpDir
-}
-
-func (r *Registry) SetTempDir(s string) {
-	r.tmpDir = s
-}
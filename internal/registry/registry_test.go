@@ -1,14 +1,18 @@
 package registry
 
 import (
+	"encoding/json"
 	"log"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/jedwards1230/go-kerbal/internal/ckan"
 	"github.com/jedwards1230/go-kerbal/internal/config"
 	"github.com/jedwards1230/go-kerbal/internal/database"
 	"github.com/jedwards1230/go-kerbal/internal/queue"
+	"github.com/spf13/viper"
+	"github.com/tidwall/buntdb"
 )
 
 var reg *Registry
@@ -16,6 +20,10 @@ var db *database.CkanDB
 var logPath = "../../logs/registry_test.log"
 
 func TestMain(m *testing.M) {
+	if kerbalDir := os.Getenv(stagingHelperEnv); kerbalDir != "" {
+		runStagingHelper(kerbalDir)
+	}
+
 	// Create log dir
 	err := os.MkdirAll("../../logs", os.ModePerm)
 	if err != nil {
@@ -91,8 +99,82 @@ func BenchmarkGetEntireModList(b *testing.B) {
 	}
 }
 
+// Store mods under their "mod:<repo>:<path>" keys in a fresh database
+func storedModsRegistry(t *testing.T, stored map[string]ckan.Ckan) *Registry {
+	r := &Registry{DB: database.GetDB(":memory:")}
+	err := r.DB.Update(func(tx *buntdb.Tx) error {
+		for key, mod := range stored {
+			mod.SourceRepo = strings.Split(key, ":")[1]
+			data, err := json.Marshal(mod)
+			if err != nil {
+				return err
+			}
+			tx.Set(key, string(data), nil)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestGetEntireModListRepoPriority(t *testing.T) {
+	viper.Set("settings.meta_repos", []map[string]interface{}{
+		{"name": "upstream", "url": "https://example.com/upstream.git", "priority": 0},
+		{"name": "team", "url": "https://example.com/team.git", "priority": 10},
+	})
+	defer viper.Set("settings.meta_repos", []map[string]interface{}{})
+
+	r := storedModsRegistry(t, map[string]ckan.Ckan{
+		"mod:upstream:Foo-1.ckan": testMod("Foo", "1.0"),
+		"mod:upstream:Foo-2.ckan": testMod("Foo", "2.0"),
+		"mod:upstream:Bar-1.ckan": testMod("Bar", "1.0"),
+		"mod:team:Foo-1.ckan":     testMod("Foo", "1.0-patched"),
+	})
+
+	modMap := r.GetEntireModList()
+	if foo := modMap["Foo"]; len(foo) != 1 || foo[0].SourceRepo != "team" {
+		t.Errorf("Foo not overridden by team repo: %+v", foo)
+	}
+	if bar := modMap["Bar"]; len(bar) != 1 || bar[0].SourceRepo != "upstream" {
+		t.Errorf("Bar missing from upstream repo: %+v", bar)
+	}
+}
+
+func TestGetEntireModListRepoOrder(t *testing.T) {
+	// keys are read in order, so "alpha" is seen before "zulu" either way
+	for _, first := range []string{"alpha", "zulu"} {
+		second := "zulu"
+		if first == "zulu" {
+			second = "alpha"
+		}
+		viper.Set("settings.meta_repos", []map[string]interface{}{
+			{"name": first, "url": "https://example.com/first.git"},
+			{"name": second, "url": "https://example.com/second.git"},
+		})
+
+		r := storedModsRegistry(t, map[string]ckan.Ckan{
+			"mod:alpha:Foo-1.ckan": testMod("Foo", "1.0"),
+			"mod:alpha:Foo-2.ckan": testMod("Foo", "2.0"),
+			"mod:zulu:Foo-1.ckan":  testMod("Foo", "1.0-fork"),
+		})
+
+		foo := r.GetEntireModList()["Foo"]
+		if len(foo) == 0 {
+			t.Fatalf("Foo missing with %v listed first", first)
+		}
+		for _, mod := range foo {
+			if mod.SourceRepo != first {
+				t.Errorf("Foo %v taken from %v, want only %v: %+v", mod.Versions.Mod, mod.SourceRepo, first, foo)
+			}
+		}
+	}
+	viper.Set("settings.meta_repos", []map[string]interface{}{})
+}
+
 func TestGetCompatibleModMap(t *testing.T) {
-	modlist := getCompatibleModMap(reg.TotalModMap)
+	modlist := getCompatibleModMap(reg.TotalModMap, gameVersions(config.GetConfig()))
 	if modlist == nil && len(modlist) > 0 {
 		t.Errorf("Mod list came back nil. Length: %v | Type: %T", len(modlist), modlist)
 	}
@@ -100,7 +182,7 @@ func TestGetCompatibleModMap(t *testing.T) {
 
 func BenchmarkGetCompatibleModMap(b *testing.B) {
 	for n := 0; n < b.N; n++ {
-		modlist := getCompatibleModMap(reg.TotalModMap)
+		modlist := getCompatibleModMap(reg.TotalModMap, gameVersions(config.GetConfig()))
 		if modlist == nil && len(modlist) > 0 {
 			b.Errorf("Mod list came back nil. Length: %v | Type: %T", len(modlist), modlist)
 		}
@@ -120,3 +202,97 @@ func BenchmarkSortModMap(b *testing.B) {
 		}
 	}
 }
+
+func kspMod(id, ksp, min, max string) ckan.Ckan {
+	mod := testMod(id, "1.0")
+	mod.Versions.Ksp, _ = ckan.NewGameVersionRange(ksp, min, max, false)
+	return mod
+}
+
+func TestUpdateCompatibilityExtraVersions(t *testing.T) {
+	oldDir := viper.GetString("settings.kerbal_dir")
+	oldVer := viper.GetString("settings.kerbal_ver")
+	oldInstances := viper.Get("settings.instance_versions")
+	t.Cleanup(func() {
+		viper.Set("settings.kerbal_dir", oldDir)
+		viper.Set("settings.kerbal_ver", oldVer)
+		viper.Set("settings.instance_versions", oldInstances)
+	})
+	viper.Set("settings.kerbal_dir", "/ksp/main")
+	viper.Set("settings.kerbal_ver", "1.12.3")
+	viper.Set("settings.instance_versions", []map[string]interface{}{})
+
+	r := testRegistry(
+		kspMod("Current", "1.12", "", ""),
+		kspMod("Old", "1.11", "", ""),
+		kspMod("Range", "", "1.8", "1.10"),
+		kspMod("Ancient", "", "", "1.4"),
+	)
+
+	tests := []struct {
+		name  string
+		extra []string
+		want  map[string]bool
+	}{
+		{
+			name: "installed version only",
+			want: map[string]bool{"Current": true, "Old": false, "Range": false, "Ancient": false},
+		},
+		{
+			name:  "extra version",
+			extra: []string{"1.11"},
+			want:  map[string]bool{"Current": true, "Old": true, "Range": false, "Ancient": false},
+		},
+		{
+			name:  "extra version inside range",
+			extra: []string{"1.9"},
+			want:  map[string]bool{"Current": true, "Old": false, "Range": true, "Ancient": false},
+		},
+	}
+
+	for _, test := range tests {
+		config.SetCompatibleVersions("/ksp/main", test.extra)
+		// another install's versions never apply here
+		config.SetCompatibleVersions("/ksp/other", []string{"1.4"})
+
+		r.updateCompatibility(gameVersions(config.GetConfig()))
+		for id, want := range test.want {
+			if got := r.TotalModMap[id][0].IsCompatible; got != want {
+				t.Errorf("%v: %v compatible = %v, want %v", test.name, id, got, want)
+			}
+		}
+	}
+}
+
+func TestUpdateCompatibilityRange(t *testing.T) {
+	oldVer := viper.GetString("settings.kerbal_ver")
+	t.Cleanup(func() { viper.Set("settings.kerbal_ver", oldVer) })
+
+	r := testRegistry(
+		kspMod("Range", "", "1.8", "1.10"),
+		kspMod("From", "", "1.9", ""),
+		kspMod("Upto", "", "", "1.8"),
+		kspMod("Any", "any", "", ""),
+	)
+
+	tests := []struct {
+		kerbalVer string
+		want      map[string]bool
+	}{
+		{"1.7.3", map[string]bool{"Range": false, "From": false, "Upto": true, "Any": true}},
+		{"1.8.1", map[string]bool{"Range": true, "From": false, "Upto": true, "Any": true}},
+		{"1.10.1", map[string]bool{"Range": true, "From": true, "Upto": false, "Any": true}},
+		{"1.12.3", map[string]bool{"Range": false, "From": true, "Upto": false, "Any": true}},
+	}
+
+	// compatibility follows the configured version without a re-import
+	for _, test := range tests {
+		viper.Set("settings.kerbal_ver", test.kerbalVer)
+		r.updateCompatibility(gameVersions(config.GetConfig()))
+		for id, want := range test.want {
+			if got := r.TotalModMap[id][0].IsCompatible; got != want {
+				t.Errorf("KSP %v: %v compatible = %v, want %v", test.kerbalVer, id, got, want)
+			}
+		}
+	}
+}
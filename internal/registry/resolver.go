@@ -0,0 +1,349 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/common"
+	"github.com/jedwards1230/go-kerbal/internal/queue"
+)
+
+// Limit on resolution steps before giving up on a queue
+const maxResolveSteps = 10000
+
+// Plan is the set of mods needed to install the queued selections
+type Plan struct {
+	Install map[string]ckan.Ckan
+	Choices []queue.Choice
+}
+
+// A relationship waiting to be satisfied and the chain of mods that required it
+type requirement struct {
+	rel      ckan.Relationship
+	chain    []string
+	selected bool
+}
+
+func (req requirement) requester() string {
+	if len(req.chain) == 0 {
+		return ""
+	}
+	return req.chain[len(req.chain)-1]
+}
+
+func (req requirement) String() string {
+	return strings.Join(append(append([]string{}, req.chain...), req.rel.String()), " -> ")
+}
+
+type resolver struct {
+	reg       *Registry
+	installed map[string]ckan.Ckan
+	preferred map[string]ckan.Ckan
+	assigned  map[string]ckan.Ckan
+	choices   []queue.Choice
+	versions  map[string][]ckan.Ckan
+	failure   requirement
+	reason    string
+	steps     int
+}
+
+// Resolve the selections against the installed mods
+//
+// Dependencies are walked transitively. Each requirement tries every version
+// in TotalModMap from newest to oldest, backtracking when a later requirement
+// cannot be met. Requirements that several different mods could satisfy are
+// returned as choices unless one of them is preferred.
+func (r *Registry) Resolve(selections, installed, preferred map[string]ckan.Ckan) (Plan, error) {
+	s := &resolver{
+		reg:       r,
+		installed: installed,
+		preferred: preferred,
+		assigned:  make(map[string]ckan.Ckan),
+		choices:   make([]queue.Choice, 0),
+		versions:  make(map[string][]ckan.Ckan),
+	}
+
+	ids := make([]string, 0, len(selections))
+	for id := range selections {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	pending := make([]requirement, 0, len(ids))
+	for _, id := range ids {
+		pending = append(pending, requirement{
+			rel:      ckan.Relationship{Name: id},
+			selected: true,
+		})
+	}
+
+	if !s.solve(pending) {
+		if s.steps > maxResolveSteps {
+			return Plan{}, fmt.Errorf("cannot resolve queue: gave up after %d steps", maxResolveSteps)
+		}
+		return Plan{}, fmt.Errorf("cannot resolve %v: %v", s.failure, s.reason)
+	}
+
+	for _, mod := range s.assigned {
+		if !mod.IsCompatible {
+			common.LogWarningf("Warning: %v is not compatible with your current configuration", mod.Name)
+		}
+	}
+
+	return Plan{
+		Install: s.assigned,
+		Choices: s.choices,
+	}, nil
+}
+
+func (s *resolver) solve(pending []requirement) bool {
+	if len(pending) == 0 {
+		return true
+	}
+
+	s.steps++
+	if s.steps > maxResolveSteps {
+		return false
+	}
+
+	req, rest := pending[0], pending[1:]
+
+	if s.satisfied(req) {
+		return s.solve(rest)
+	}
+
+	candidates := s.candidates(req)
+	if len(candidates) == 0 {
+		s.fail(req, s.missingReason(req))
+		return false
+	}
+
+	// only offer mods that can go in next to what is already picked
+	usable := make([]ckan.Ckan, 0, len(candidates))
+	for _, candidate := range candidates {
+		if reason := s.conflict(candidate); reason != "" {
+			s.fail(req, reason)
+			continue
+		}
+		usable = append(usable, candidate)
+	}
+	candidates = usable
+
+	// several mods could satisfy this, leave it to the user
+	if options := latestPerIdentifier(candidates); len(options) > 1 {
+		if id, ok := s.preferredOption(options); ok {
+			candidates = filterIdentifier(candidates, id)
+		} else {
+			help := req.rel.ChoiceHelp
+			if help == "" {
+				help = fmt.Sprintf("%v depends on %v", req.requester(), req.rel)
+			}
+			s.choices = append(s.choices, queue.Choice{
+				Requester: req.requester(),
+				Help:      help,
+				Options:   options,
+			})
+			return s.solve(rest)
+		}
+	}
+
+	for _, candidate := range candidates {
+		mark := len(s.choices)
+		s.assigned[candidate.Identifier] = candidate
+
+		chain := append(append([]string{}, req.chain...), candidate.Identifier)
+		next := make([]requirement, 0, len(candidate.ModDepends)+len(rest))
+		for _, depends := range candidate.ModDepends {
+			next = append(next, requirement{rel: depends, chain: chain})
+		}
+		next = append(next, rest...)
+
+		if s.solve(next) {
+			return true
+		}
+
+		delete(s.assigned, candidate.Identifier)
+		s.choices = s.choices[:mark]
+		if s.steps > maxResolveSteps {
+			return false
+		}
+	}
+	return false
+}
+
+// Check if an installed or already picked mod meets the requirement
+//
+// Installed mods without an install record have an unknown version, so
+// they match by name only
+func (s *resolver) satisfied(req requirement) bool {
+	for _, alt := range alternatives(req.rel) {
+		for id, mod := range s.installed {
+			if req.selected || !mod.ProvidesIdentifier(alt.Name) {
+				continue
+			}
+			if _, tracked := s.reg.Manifests[id]; !tracked || mod.Identifier != alt.Name || alt.VersionMatches(mod) {
+				return true
+			}
+		}
+		for _, mod := range s.assigned {
+			if req.selected && mod.Identifier != alt.Name {
+				continue
+			}
+			if alt.MatchedBy(mod) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// List every mod version that could satisfy the requirement
+//
+// Providers are listed in index order with newer versions first. Selections
+// fall back to incompatible versions so explicit picks still install.
+func (s *resolver) candidates(req requirement) []ckan.Ckan {
+	compatible := make([]ckan.Ckan, 0)
+	incompatible := make([]ckan.Ckan, 0)
+
+	for _, alt := range alternatives(req.rel) {
+		providers := s.reg.ProvidesIndex[alt.Name]
+		if req.selected {
+			providers = []string{alt.Name}
+		}
+
+		for _, id := range providers {
+			// a different version is already in place
+			if _, ok := s.assigned[id]; ok {
+				continue
+			}
+			if _, ok := s.installed[id]; ok {
+				continue
+			}
+
+			for _, mod := range s.sortedVersions(id) {
+				if !mod.ProvidesIdentifier(alt.Name) {
+					continue
+				}
+				if mod.Identifier == alt.Name && !alt.VersionMatches(mod) {
+					continue
+				}
+				if mod.IsCompatible {
+					compatible = append(compatible, mod)
+				} else if req.selected {
+					incompatible = append(incompatible, mod)
+				}
+			}
+		}
+	}
+	return append(compatible, incompatible...)
+}
+
+// Describe any conflict between the candidate and installed or picked mods
+func (s *resolver) conflict(candidate ckan.Ckan) string {
+	check := func(mods map[string]ckan.Ckan, state string) string {
+		for id, mod := range mods {
+			if id == candidate.Identifier {
+				continue
+			}
+			for _, conflict := range candidate.ModConflicts {
+				if conflict.MatchedBy(mod) {
+					return fmt.Sprintf("%v conflicts with %s %v", candidate.Identifier, state, id)
+				}
+			}
+			for _, conflict := range mod.ModConflicts {
+				if conflict.MatchedBy(candidate) {
+					return fmt.Sprintf("%s %v conflicts with %v", state, id, candidate.Identifier)
+				}
+			}
+		}
+		return ""
+	}
+
+	if reason := check(s.installed, "installed"); reason != "" {
+		return reason
+	}
+	return check(s.assigned, "queued")
+}
+
+// Explain why a requirement has no candidates
+func (s *resolver) missingReason(req requirement) string {
+	for _, alt := range alternatives(req.rel) {
+		if mod, ok := s.assigned[alt.Name]; ok {
+			return fmt.Sprintf("%v %v is already queued", alt.Name, mod.Versions.Mod)
+		}
+		if mod, ok := s.installed[alt.Name]; ok {
+			return fmt.Sprintf("%v %v is installed", alt.Name, mod.Versions.Mod)
+		}
+	}
+	for _, alt := range alternatives(req.rel) {
+		if len(s.reg.ProvidesIndex[alt.Name]) > 0 {
+			return "no compatible version available"
+		}
+	}
+	return "not found in the mod list"
+}
+
+// Record the deepest failure to explain why resolution failed
+func (s *resolver) fail(req requirement, reason string) {
+	if s.reason == "" || len(req.chain) >= len(s.failure.chain) {
+		s.failure = req
+		s.reason = reason
+	}
+}
+
+// Find a candidate the user has already picked
+func (s *resolver) preferredOption(options []ckan.Ckan) (string, bool) {
+	for _, option := range options {
+		if _, ok := s.preferred[option.Identifier]; ok {
+			return option.Identifier, true
+		}
+	}
+	return "", false
+}
+
+// All versions of a mod, newest first
+func (s *resolver) sortedVersions(id string) []ckan.Ckan {
+	if versions, ok := s.versions[id]; ok {
+		return versions
+	}
+
+	versions := append([]ckan.Ckan{}, s.reg.TotalModMap[id]...)
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Versions.Mod.GreaterThan(versions[j].Versions.Mod)
+	})
+	s.versions[id] = versions
+	return versions
+}
+
+// Plain relationships are treated as a single alternative
+func alternatives(rel ckan.Relationship) []ckan.Relationship {
+	if rel.IsAnyOf() {
+		return rel.AnyOf
+	}
+	return []ckan.Relationship{rel}
+}
+
+// Keep the first, newest, candidate of each identifier
+func latestPerIdentifier(candidates []ckan.Ckan) []ckan.Ckan {
+	options := make([]ckan.Ckan, 0)
+	seen := make(map[string]bool)
+	for _, mod := range candidates {
+		if !seen[mod.Identifier] {
+			seen[mod.Identifier] = true
+			options = append(options, mod)
+		}
+	}
+	return options
+}
+
+func filterIdentifier(candidates []ckan.Ckan, id string) []ckan.Ckan {
+	filtered := make([]ckan.Ckan, 0)
+	for _, mod := range candidates {
+		if mod.Identifier == id {
+			filtered = append(filtered, mod)
+		}
+	}
+	return filtered
+}
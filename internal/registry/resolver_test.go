@@ -0,0 +1,307 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+	"github.com/jedwards1230/go-kerbal/internal/database"
+	"github.com/jedwards1230/go-kerbal/internal/queue"
+)
+
+func testMod(id, version string, depends ...ckan.Relationship) ckan.Ckan {
+	mod := ckan.Ckan{
+		Identifier:   id,
+		Name:         id,
+		IsCompatible: true,
+		ModDepends:   depends,
+	}
+	mod.Versions.Mod, _ = ckan.ParseVersion(version)
+	return mod
+}
+
+func testRegistry(mods ...ckan.Ckan) *Registry {
+	r := &Registry{TotalModMap: make(map[string][]ckan.Ckan)}
+	for _, mod := range mods {
+		r.TotalModMap[mod.Identifier] = append(r.TotalModMap[mod.Identifier], mod)
+	}
+	r.UnsortedModMap = getLatestVersionMap(r.TotalModMap)
+	r.buildProvidesIndex()
+	return r
+}
+
+func TestResolveBacktracks(t *testing.T) {
+	r := testRegistry(
+		testMod("A", "2.0", ckan.Relationship{Name: "B", MinVersion: "2.0"}),
+		testMod("A", "1.0", ckan.Relationship{Name: "B", MinVersion: "1.0"}),
+		testMod("B", "1.5", ckan.Relationship{Name: "C"}),
+		testMod("C", "1.0"),
+	)
+
+	selections := map[string]ckan.Ckan{"A": r.UnsortedModMap["A"]}
+	plan, err := r.Resolve(selections, nil, nil)
+	if err != nil {
+		t.Fatalf("could not resolve: %v", err)
+	}
+	if plan.Install["A"].Versions.Mod.String() != "1.0" {
+		t.Errorf("expected A 1.0, got %v", plan.Install["A"].Versions.Mod)
+	}
+	if plan.Install["C"].Identifier == "" {
+		t.Errorf("transitive dependency C missing from plan: %v", plan.Install)
+	}
+}
+
+func TestResolveConflictChain(t *testing.T) {
+	blocker := testMod("E", "1.0")
+	conflicted := testMod("D", "1.0")
+	conflicted.ModConflicts = []ckan.Relationship{{Name: "E"}}
+
+	r := testRegistry(
+		testMod("C", "1.0", ckan.Relationship{Name: "D"}),
+		conflicted,
+		blocker,
+	)
+
+	selections := map[string]ckan.Ckan{"C": r.UnsortedModMap["C"]}
+	installed := map[string]ckan.Ckan{"E": blocker}
+	_, err := r.Resolve(selections, installed, nil)
+	if err == nil {
+		t.Fatal("expected conflict with installed mod")
+	}
+	if !strings.Contains(err.Error(), "C -> D") || !strings.Contains(err.Error(), "installed E") {
+		t.Errorf("unexpected explanation: %v", err)
+	}
+}
+
+func TestResolveProviders(t *testing.T) {
+	first := testMod("G", "1.0")
+	first.Provides = []string{"Virtual"}
+	second := testMod("H", "1.0")
+	second.Provides = []string{"Virtual"}
+
+	r := testRegistry(
+		testMod("F", "1.0", ckan.Relationship{Name: "Virtual"}),
+		first,
+		second,
+	)
+
+	selections := map[string]ckan.Ckan{"F": r.UnsortedModMap["F"]}
+	plan, err := r.Resolve(selections, nil, nil)
+	if err != nil {
+		t.Fatalf("could not resolve: %v", err)
+	}
+	if len(plan.Choices) != 1 || len(plan.Choices[0].Options) != 2 {
+		t.Fatalf("expected a choice between providers, got %v", plan.Choices)
+	}
+
+	preferred := map[string]ckan.Ckan{"H": second}
+	plan, err = r.Resolve(selections, nil, preferred)
+	if err != nil {
+		t.Fatalf("could not resolve: %v", err)
+	}
+	if len(plan.Choices) != 0 || plan.Install["H"].Identifier == "" {
+		t.Errorf("expected preferred provider H, got %v", plan.Install)
+	}
+}
+
+func TestResolveInstalledVersion(t *testing.T) {
+	installedB := testMod("B", "1.0")
+	r := testRegistry(
+		testMod("A", "1.0", ckan.Relationship{Name: "B", MinVersion: "2.0"}),
+		installedB,
+		testMod("B", "2.0"),
+	)
+	selections := map[string]ckan.Ckan{"A": r.UnsortedModMap["A"]}
+	installed := map[string]ckan.Ckan{"B": installedB}
+
+	// untracked installs have no known version
+	if _, err := r.Resolve(selections, installed, nil); err != nil {
+		t.Fatalf("untracked install should satisfy by name: %v", err)
+	}
+
+	r.Manifests = map[string]database.InstalledMod{"B": {Identifier: "B", Version: "1.0"}}
+	_, err := r.Resolve(selections, installed, nil)
+	if err == nil || !strings.Contains(err.Error(), "B 1.0 is installed") {
+		t.Errorf("expected installed version to be rejected, got %v", err)
+	}
+}
+
+func TestResolveQueueRequiredRemoval(t *testing.T) {
+	dep := testMod("B", "1.0")
+	dep.SetInstalled(true)
+	r := testRegistry(
+		testMod("A", "1.0", ckan.Relationship{Name: "B"}),
+		dep,
+	)
+	r.Queue = queue.New()
+	r.InstalledModList = map[string]ckan.Ckan{"B": dep}
+
+	if err := r.AddToQueue(dep); err != nil {
+		t.Fatalf("could not queue removal: %v", err)
+	}
+	err := r.AddToQueue(r.UnsortedModMap["A"])
+	if err == nil || !strings.Contains(err.Error(), "queued for removal") {
+		t.Fatalf("expected required removal to be rejected, got %v", err)
+	}
+	if r.Queue.CheckQueue("A") {
+		t.Error("rejected selection left in queue")
+	}
+
+	// queueing the removal after the mod that needs it is rejected too
+	r.Queue = queue.New()
+	if err := r.AddToQueue(r.UnsortedModMap["A"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddToQueue(dep); err == nil {
+		t.Fatal("expected removal of a required mod to be rejected")
+	}
+	if r.Queue.CheckRemovals("B") {
+		t.Error("rejected removal left in queue")
+	}
+}
+
+func TestCheckConflictsVersionBound(t *testing.T) {
+	a := testMod("A", "1.0")
+	a.ModConflicts = []ckan.Relationship{{Name: "B", MaxVersion: "1.0"}}
+
+	tests := []struct {
+		b       string
+		wantErr bool
+	}{
+		{"1.0", true},
+		{"2.0", false},
+	}
+
+	for _, test := range tests {
+		b := testMod("B", test.b)
+		r := testRegistry(a, b)
+		r.Queue = queue.New()
+		r.InstalledModList = make(map[string]ckan.Ckan)
+
+		// the resolver and the download check must agree
+		_, resolveErr := r.Resolve(map[string]ckan.Ckan{"A": a, "B": b}, r.InstalledModList, nil)
+		err := r.checkConflicts([]ckan.Ckan{a, b})
+		if (err != nil) != test.wantErr || (resolveErr != nil) != test.wantErr {
+			t.Errorf("B %v: checkConflicts error %v, Resolve error %v, want error %v", test.b, err, resolveErr, test.wantErr)
+		}
+	}
+}
+
+func choiceRegistry() *Registry {
+	first := testMod("G", "1.0")
+	first.Provides = []string{"Virtual"}
+	// offered, but its own dependency can't be found
+	broken := testMod("H", "1.0", ckan.Relationship{Name: "Gone"})
+	broken.Provides = []string{"Virtual"}
+	conflicted := testMod("J", "1.0")
+	conflicted.Provides = []string{"Virtual"}
+	conflicted.ModConflicts = []ckan.Relationship{{Name: "E"}}
+	blocker := testMod("E", "1.0")
+
+	r := testRegistry(
+		testMod("F", "1.0", ckan.Relationship{Name: "Virtual"}),
+		first,
+		broken,
+		conflicted,
+		blocker,
+	)
+	r.Queue = queue.New()
+	r.InstalledModList = map[string]ckan.Ckan{"E": blocker}
+	return r
+}
+
+func TestResolveChoiceSkipsConflicts(t *testing.T) {
+	r := choiceRegistry()
+	selections := map[string]ckan.Ckan{"F": r.UnsortedModMap["F"]}
+	plan, err := r.Resolve(selections, r.InstalledModList, nil)
+	if err != nil {
+		t.Fatalf("could not resolve: %v", err)
+	}
+	if len(plan.Choices) != 1 {
+		t.Fatalf("expected a choice, got %v", plan.Choices)
+	}
+	for _, option := range plan.Choices[0].Options {
+		if option.Identifier == "J" {
+			t.Errorf("conflicting J offered: %v", plan.Choices[0].Options)
+		}
+	}
+
+	// with one usable provider left there is nothing to choose
+	delete(r.TotalModMap, "H")
+	r.UnsortedModMap = getLatestVersionMap(r.TotalModMap)
+	r.buildProvidesIndex()
+	plan, err = r.Resolve(selections, r.InstalledModList, nil)
+	if err != nil {
+		t.Fatalf("could not resolve: %v", err)
+	}
+	if len(plan.Choices) != 0 || plan.Install["G"].Identifier == "" {
+		t.Errorf("expected G without a choice, got %v and %v", plan.Choices, plan.Install)
+	}
+}
+
+func TestAddToQueueChoice(t *testing.T) {
+	r := choiceRegistry()
+	if err := r.AddToQueue(r.UnsortedModMap["F"]); err != nil {
+		t.Fatal(err)
+	}
+	if r.Queue.ChoiceLen() != 1 {
+		t.Fatalf("expected a pending choice, got %d", r.Queue.ChoiceLen())
+	}
+
+	if err := r.AddToQueue(r.UnsortedModMap["G"]); err != nil {
+		t.Fatalf("could not pick G: %v", err)
+	}
+	if r.Queue.ChoiceLen() != 0 {
+		t.Errorf("choice still pending after picking G")
+	}
+	if _, ok := r.Queue.GetDependencies()["G"]; !ok {
+		t.Errorf("G not queued as a dependency: %v", r.Queue.GetDependencies())
+	}
+	if _, ok := r.Queue.GetSelections()["F"]; !ok {
+		t.Error("F dropped from selections")
+	}
+}
+
+func TestAddToQueueFailedChoice(t *testing.T) {
+	r := choiceRegistry()
+	if err := r.AddToQueue(r.UnsortedModMap["F"]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.AddToQueue(r.UnsortedModMap["H"]); err == nil {
+		t.Fatal("expected H to fail on its missing dependency")
+	}
+	if _, ok := r.Queue.GetSelections()["F"]; !ok {
+		t.Error("F dropped from selections after a failed pick")
+	}
+	if r.Queue.CheckQueue("H") {
+		t.Error("failed option left in queue")
+	}
+	if r.Queue.ChoiceLen() != 1 {
+		t.Errorf("expected the choice to stay pending, got %d", r.Queue.ChoiceLen())
+	}
+}
+
+func TestResolveProviderIgnoresVersionBounds(t *testing.T) {
+	provider := testMod("P", "2.0")
+	provider.Provides = []string{"Virtual"}
+	a := testMod("A", "1.0")
+	a.ModConflicts = []ckan.Relationship{{Name: "Virtual", MaxVersion: "1.0"}}
+	r := testRegistry(
+		a,
+		provider,
+		testMod("B", "1.0", ckan.Relationship{Name: "Virtual", MinVersion: "3.0"}),
+	)
+
+	// P's own version says nothing about the virtual name it provides
+	plan, err := r.Resolve(map[string]ckan.Ckan{"B": r.UnsortedModMap["B"], "P": provider}, nil, nil)
+	if err != nil {
+		t.Fatalf("provider did not satisfy bounded depends: %v", err)
+	}
+	if len(plan.Install) != 2 {
+		t.Errorf("unexpected plan: %v", plan.Install)
+	}
+	if _, err := r.Resolve(map[string]ckan.Ckan{"A": a, "P": provider}, nil, nil); err == nil {
+		t.Error("provider escaped bounded conflict")
+	}
+}
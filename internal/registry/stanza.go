@@ -0,0 +1,277 @@
+package registry
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+)
+
+// Archive entry and where it is installed, relative to the KSP root
+type installFile struct {
+	Entry  *zip.File
+	Target string
+}
+
+// Junk some archives ship that is never installed
+var defaultFilters = []string{"__MACOSX", ".DS_Store", "Thumbs.db"}
+
+// Map every archive entry a mod installs to its target path
+//
+// Each install stanza is applied in order. An entry claimed twice for the
+// same target is installed once; two entries fighting over one target is
+// an error.
+func mapInstallFiles(mod ckan.Ckan, files []*zip.File) ([]installFile, error) {
+	entries := make(map[string]*zip.File, len(files))
+	for _, f := range files {
+		name := strings.Trim(path.Clean(strings.ReplaceAll(f.Name, "\\", "/")), "/")
+		if !f.FileInfo().IsDir() && name != "." {
+			entries[name] = f
+		}
+	}
+
+	mapped := make([]installFile, 0)
+	targets := make(map[string]*zip.File)
+	for i, stanza := range mod.Install.Stanzas {
+		stanzaFiles, err := mapStanza(stanza, entries)
+		if err != nil {
+			return nil, fmt.Errorf("install stanza %d: %v", i+1, err)
+		}
+
+		for _, file := range stanzaFiles {
+			key := strings.ToLower(file.Target)
+			if existing, ok := targets[key]; ok {
+				if existing != file.Entry {
+					return nil, fmt.Errorf("%v and %v both install to %v", existing.Name, file.Entry.Name, file.Target)
+				}
+				continue
+			}
+			targets[key] = file.Entry
+			mapped = append(mapped, file)
+		}
+	}
+
+	if len(mapped) == 0 {
+		return nil, fmt.Errorf("no files to install for %v", mod.Name)
+	}
+	return mapped, nil
+}
+
+// Map the entries matched by a single stanza
+func mapStanza(stanza ckan.InstallStanza, entries map[string]*zip.File) ([]installFile, error) {
+	root, err := findStanzaRoot(stanza, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := compileAll(stanza.FilterRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter_regexp: %v", err)
+	}
+	includes, err := compileAll(stanza.IncludeOnlyRegex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include_only_regexp: %v", err)
+	}
+
+	filterNames := append(append([]string{}, defaultFilters...), stanza.Filter...)
+
+	name := path.Base(root)
+	if stanza.As != "" {
+		name = stanza.As
+	}
+	installTo, err := resolveInstallTo(stanza.InstallTo)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]installFile, 0)
+	for entryName, f := range entries {
+		if entryName != root && !strings.HasPrefix(entryName, root+"/") {
+			continue
+		}
+
+		if !stanzaIncludes(stanza, entryName, filterNames, filters, includes) {
+			continue
+		}
+
+		// path below the matched file or folder
+		rel := strings.TrimPrefix(entryName, root)
+
+		target := path.Join(installTo, name+rel)
+		if target == ".." || strings.HasPrefix(target, "../") || path.IsAbs(target) {
+			return nil, fmt.Errorf("invalid install path: %v", target)
+		}
+		files = append(files, installFile{Entry: f, Target: target})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Target < files[j].Target
+	})
+	return files, nil
+}
+
+// Find the archive path a stanza installs
+//
+// find and find_regexp pick the top-most matching folder, or file when
+// find_matches_files is set. file must name an exact path.
+func findStanzaRoot(stanza ckan.InstallStanza, entries map[string]*zip.File) (string, error) {
+	if stanza.File != "" {
+		file := strings.Trim(path.Clean(stanza.File), "/")
+		for entryName := range entries {
+			if entryName == file || strings.HasPrefix(entryName, file+"/") {
+				return file, nil
+			}
+		}
+		return "", fmt.Errorf("file not in archive: %v", stanza.File)
+	}
+
+	var re *regexp.Regexp
+	var err error
+	if stanza.Find != "" {
+		re, err = regexp.Compile("(?:^|/)" + regexp.QuoteMeta(strings.Trim(stanza.Find, "/")) + "$")
+	} else {
+		re, err = regexp.Compile(stanza.FindRegex)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid find_regexp: %v", err)
+	}
+
+	candidates := make(map[string]bool)
+	for entryName := range entries {
+		if stanza.FindMatchesFiles {
+			candidates[entryName] = true
+		}
+		for dir := path.Dir(entryName); dir != "."; dir = path.Dir(dir) {
+			candidates[dir] = true
+		}
+	}
+
+	best := ""
+	for candidate := range candidates {
+		if !re.MatchString(candidate) {
+			continue
+		}
+		if best == "" || shallower(candidate, best) {
+			best = candidate
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("nothing in archive matches %v", stanza.Find+stanza.FindRegex)
+	}
+	return best, nil
+}
+
+// Returns true if a sits higher in the tree than b
+//
+// Ties prefer folders shipped inside a GameData folder, then go by name.
+func shallower(a, b string) bool {
+	depthA, depthB := strings.Count(a, "/"), strings.Count(b, "/")
+	if depthA != depthB {
+		return depthA < depthB
+	}
+	inA, inB := underGameData(a), underGameData(b)
+	if inA != inB {
+		return inA
+	}
+	return a < b
+}
+
+func underGameData(p string) bool {
+	return strings.Contains(strings.ToLower("/"+p), "/gamedata/")
+}
+
+// Apply filters and include_only rules to an entry
+//
+// Name filters match any single component of the archive path, including
+// folders above the stanza root. Regex filters match the full archive path.
+// Metadata files shipped in the archive are never installed.
+func stanzaIncludes(stanza ckan.InstallStanza, entryName string, filterNames []string, filters, includes []*regexp.Regexp) bool {
+	if strings.EqualFold(path.Ext(entryName), ".ckan") {
+		return false
+	}
+	components := strings.Split(entryName, "/")
+
+	for _, component := range components {
+		for _, filter := range filterNames {
+			if strings.EqualFold(component, filter) {
+				return false
+			}
+		}
+	}
+	for _, re := range filters {
+		if re.MatchString(entryName) {
+			return false
+		}
+	}
+
+	if len(stanza.IncludeOnly) == 0 && len(includes) == 0 {
+		return true
+	}
+	for _, component := range components {
+		for _, include := range stanza.IncludeOnly {
+			if strings.EqualFold(component, include) {
+				return true
+			}
+		}
+	}
+	for _, re := range includes {
+		if re.MatchString(entryName) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Top-level GameData entries a mod is expected to create
+//
+// Stanzas installing into a GameData subfolder only report that folder
+// when shared is true, since other mods may install there too.
+func gameDataNames(mod ckan.Ckan, shared bool) ([]string, []*regexp.Regexp) {
+	names := make([]string, 0)
+	patterns := make([]*regexp.Regexp, 0)
+	for _, stanza := range mod.Install.Stanzas {
+		installTo, err := resolveInstallTo(stanza.InstallTo)
+		switch {
+		case err != nil:
+			continue
+		case installTo == "GameData":
+		case strings.HasPrefix(installTo, "GameData/"):
+			if shared {
+				names = append(names, strings.Split(installTo, "/")[1])
+			}
+			continue
+		default:
+			continue
+		}
+
+		switch {
+		case stanza.As != "":
+			names = append(names, stanza.As)
+		case stanza.Find != "":
+			names = append(names, path.Base(stanza.Find))
+		case stanza.File != "":
+			names = append(names, path.Base(stanza.File))
+		case stanza.FindRegex != "":
+			if re, err := regexp.Compile(stanza.FindRegex); err == nil {
+				patterns = append(patterns, re)
+			}
+		}
+	}
+	return names, patterns
+}
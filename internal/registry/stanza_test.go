@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+)
+
+func testArchive(t *testing.T, names ...string) []*zip.File {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.File
+}
+
+func targetsOf(files []installFile) map[string]bool {
+	targets := make(map[string]bool, len(files))
+	for _, f := range files {
+		targets[f.Target] = true
+	}
+	return targets
+}
+
+func TestMapInstallFiles(t *testing.T) {
+	archive := testArchive(t,
+		"README.md",
+		"Source/Plugin.cs",
+		"Pack/GameData/Foo/Foo.dll",
+		"Pack/GameData/Foo/Parts/part.cfg",
+		"Pack/GameData/Foo/Parts/part.psd",
+		"Pack/GameData/Foo/Thumbs.db",
+		"Pack/Extras/Foo/Optional.cfg",
+		"Pack/Ships/VAB/Rocket.craft",
+	)
+
+	mod := testMod("Foo", "1.0")
+	mod.Install.Stanzas = []ckan.InstallStanza{
+		{Find: "Foo", InstallTo: "GameData", FilterRegex: []string{`\.psd$`}},
+		{File: "Pack/Ships/VAB/Rocket.craft", InstallTo: "Ships/VAB"},
+		{Find: "Optional.cfg", FindMatchesFiles: true, InstallTo: "GameData/Foo", As: "Extra.cfg"},
+	}
+
+	files, err := mapInstallFiles(mod, archive)
+	if err != nil {
+		t.Fatalf("could not map files: %v", err)
+	}
+
+	want := []string{
+		"GameData/Foo/Foo.dll",
+		"GameData/Foo/Parts/part.cfg",
+		"Ships/VAB/Rocket.craft",
+		"GameData/Foo/Extra.cfg",
+	}
+	got := targetsOf(files)
+	if len(got) != len(want) {
+		t.Errorf("expected %d files, got %v", len(want), got)
+	}
+	for _, target := range want {
+		if !got[target] {
+			t.Errorf("missing %v in %v", target, got)
+		}
+	}
+}
+
+func TestMapInstallFilesIncludeOnly(t *testing.T) {
+	archive := testArchive(t,
+		"Foo/Foo.dll",
+		"Foo/Foo.pdb",
+		"Foo/Textures/a.dds",
+	)
+
+	mod := testMod("Foo", "1.0")
+	mod.Install.Stanzas = []ckan.InstallStanza{
+		{Find: "Foo", InstallTo: "GameData", IncludeOnlyRegex: []string{`\.dll$`}, IncludeOnly: []string{"Textures"}},
+	}
+
+	files, err := mapInstallFiles(mod, archive)
+	if err != nil {
+		t.Fatalf("could not map files: %v", err)
+	}
+	got := targetsOf(files)
+	if len(got) != 2 || !got["GameData/Foo/Foo.dll"] || !got["GameData/Foo/Textures/a.dds"] {
+		t.Errorf("unexpected files: %v", got)
+	}
+}
+
+func TestMapInstallFilesMissing(t *testing.T) {
+	archive := testArchive(t, "Bar/Bar.dll")
+
+	mod := testMod("Foo", "1.0")
+	mod.Install.Stanzas = []ckan.InstallStanza{{Find: "Foo", InstallTo: "GameData"}}
+
+	if _, err := mapInstallFiles(mod, archive); err == nil {
+		t.Error("expected error for stanza matching nothing")
+	}
+}
+
+func TestMapInstallFilesParentFilters(t *testing.T) {
+	archive := testArchive(t,
+		"Pack/GameData/Foo/Foo.dll",
+		"Pack/GameData/Foo/Parts/part.cfg",
+		"Pack/Extras/Bar.cfg",
+	)
+
+	// filters see the whole archive path, not just what is below the root
+	mod := testMod("Foo", "1.0")
+	mod.Install.Stanzas = []ckan.InstallStanza{
+		{Find: "Foo", InstallTo: "GameData", IncludeOnly: []string{"GameData"}},
+		{Find: "Extras", InstallTo: "GameData/Foo", Filter: []string{"Pack"}},
+	}
+
+	files, err := mapInstallFiles(mod, archive)
+	if err != nil {
+		t.Fatalf("could not map files: %v", err)
+	}
+	got := targetsOf(files)
+	if len(got) != 2 || !got["GameData/Foo/Foo.dll"] || !got["GameData/Foo/Parts/part.cfg"] {
+		t.Errorf("unexpected files: %v", got)
+	}
+}
+
+func TestMapInstallFilesSkipsCkan(t *testing.T) {
+	archive := testArchive(t,
+		"Foo/Foo.dll",
+		"Foo/Foo.ckan",
+	)
+
+	mod := testMod("Foo", "1.0")
+	mod.Install.Stanzas = []ckan.InstallStanza{{Find: "Foo", InstallTo: "GameData"}}
+
+	files, err := mapInstallFiles(mod, archive)
+	if err != nil {
+		t.Fatalf("could not map files: %v", err)
+	}
+	if got := targetsOf(files); len(got) != 1 || !got["GameData/Foo/Foo.dll"] {
+		t.Errorf("unexpected files: %v", got)
+	}
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// install_to values accepted by CKAN, mapped to folders under the KSP root
+var installTargets = map[string]string{
+	"gamedata":          "GameData",
+	"gameroot":          "",
+	"ships":             "Ships",
+	"ships/vab":         "Ships/VAB",
+	"ships/sph":         "Ships/SPH",
+	"ships/@thumbs":     "Ships/@thumbs",
+	"ships/@thumbs/vab": "Ships/@thumbs/VAB",
+	"ships/@thumbs/sph": "Ships/@thumbs/SPH",
+	"ships/script":      "Ships/Script",
+	"scenarios":         "saves/scenarios",
+	"tutorial":          "saves/training",
+	"missions":          "Missions",
+}
+
+// Resolve an install_to value to a folder relative to the KSP root
+//
+// GameData also accepts subfolders such as GameData/Foo. GameRoot resolves
+// to the root itself, returned as an empty string.
+func resolveInstallTo(installTo string) (string, error) {
+	cleaned := strings.Trim(strings.ReplaceAll(installTo, "\\", "/"), "/")
+
+	if target, ok := installTargets[strings.ToLower(cleaned)]; ok {
+		return target, nil
+	}
+
+	if strings.HasPrefix(strings.ToLower(cleaned), "gamedata/") {
+		sub := cleaned[len("gamedata/"):]
+		for _, part := range strings.Split(sub, "/") {
+			if part == "" || part == "." || part == ".." {
+				return "", fmt.Errorf("invalid install_to: %v", installTo)
+			}
+		}
+		if top := strings.Split(sub, "/")[0]; strings.EqualFold(top, "Squad") || strings.EqualFold(top, "SquadExpansion") {
+			return "", fmt.Errorf("install_to targets stock game data: %v", installTo)
+		}
+		return path.Join("GameData", sub), nil
+	}
+
+	return "", fmt.Errorf("unknown install_to: %v", installTo)
+}
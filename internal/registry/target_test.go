@@ -0,0 +1,36 @@
+package registry
+
+import "testing"
+
+func TestResolveInstallTo(t *testing.T) {
+	tests := []struct {
+		installTo, want string
+		ok              bool
+	}{
+		{"GameData", "GameData", true},
+		{"GameData/Foo/Plugins", "GameData/Foo/Plugins", true},
+		{"GameRoot", "", true},
+		{"Ships/VAB", "Ships/VAB", true},
+		{"Ships/@thumbs/SPH", "Ships/@thumbs/SPH", true},
+		{"Scenarios", "saves/scenarios", true},
+		{"Tutorial", "saves/training", true},
+		{"Missions", "Missions", true},
+		{"GameData/../..", "", false},
+		{"GameData/Squad", "", false},
+		{"GameData/squad/Parts", "", false},
+		{"GameData/SquadExpansion", "", false},
+		{"GameData/SquadronPatches", "GameData/SquadronPatches", true},
+		{"Somewhere", "", false},
+	}
+
+	for _, test := range tests {
+		got, err := resolveInstallTo(test.installTo)
+		if (err == nil) != test.ok {
+			t.Errorf("%v: unexpected error state: %v", test.installTo, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%v: got %q, want %q", test.installTo, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package registry
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedwards1230/go-kerbal/internal/database"
+	"github.com/jedwards1230/go-kerbal/internal/dirfs"
+)
+
+// Folder under the KSP root holding staged files and backups
+const workDir = ".go-kerbal"
+
+// Kinds of change a transaction makes to a path
+const (
+	opWrite  = "write"
+	opDelete = "delete"
+)
+
+// One change to a path under the KSP root
+type txOp struct {
+	Kind    string
+	Target  string
+	Staged  string
+	Backup  string
+	Created []string
+	Done    bool
+}
+
+// Transaction applies a set of file changes to a KSP instance all at once
+//
+// New files are extracted to a staging tree first. Committing moves aside
+// anything that would be overwritten or deleted, then renames staged files
+// into place. If any step fails, every change is undone.
+type Transaction struct {
+	KerbalDir string
+	Dir       string
+	Ops       []txOp
+	Prune     []string
+
+	// backups are the only copy left after a failed rollback
+	keep bool
+}
+
+// Start a transaction with its staging tree inside the KSP directory
+//
+// Staging on the same filesystem keeps every commit step a rename.
+func newTransaction(kerbalDir string) (*Transaction, error) {
+	root := filepath.Join(kerbalDir, workDir)
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating work dir: %v", err)
+	}
+	dir, err := os.MkdirTemp(root, "tx-")
+	if err != nil {
+		return nil, fmt.Errorf("creating transaction dir: %v", err)
+	}
+	return &Transaction{KerbalDir: kerbalDir, Dir: dir}, nil
+}
+
+// Absolute path of a target relative to the KSP root
+func (tx *Transaction) path(target string) string {
+	return filepath.Join(tx.KerbalDir, filepath.FromSlash(target))
+}
+
+// Extract an archive entry into the staging tree
+//
+// Each write gets its own folder, so two mods shipping the same file don't
+// stage over each other.
+func (tx *Transaction) StageFile(target string, entry *zip.File) (database.InstalledFile, error) {
+	staged := filepath.Join(tx.Dir, "stage", strconv.Itoa(len(tx.Ops)), filepath.FromSlash(target))
+	if err := dirfs.UnzipFile(entry, staged); err != nil {
+		return database.InstalledFile{}, fmt.Errorf("staging %v: %v", target, err)
+	}
+
+	size, sum, err := dirfs.HashFile(staged)
+	if err != nil {
+		return database.InstalledFile{}, fmt.Errorf("hashing %v: %v", target, err)
+	}
+
+	tx.Ops = append(tx.Ops, txOp{Kind: opWrite, Target: target, Staged: staged})
+	return database.InstalledFile{Path: target, Size: size, Sha1: sum}, nil
+}
+
+// Queue a file or folder for deletion
+func (tx *Transaction) Delete(target string) {
+	tx.Ops = append(tx.Ops, txOp{Kind: opDelete, Target: target})
+}
+
+// Queue folders to remove after commit if they end up empty
+func (tx *Transaction) PruneIfEmpty(dirs ...string) {
+	tx.Prune = append(tx.Prune, dirs...)
+}
+
+// Record the folders each write will create
+//
+// Done before the first change so a journal of the transaction can undo
+// them after a crash.
+func (tx *Transaction) prepare() {
+	for i := range tx.Ops {
+		op := &tx.Ops[i]
+		if op.Kind == opWrite && op.Created == nil {
+			op.Created = missingDirs(tx.KerbalDir, filepath.Dir(tx.path(op.Target)))
+		}
+	}
+}
+
+func (tx *Transaction) backupPath(i int) string {
+	return filepath.Join(tx.Dir, "backup", strconv.Itoa(i))
+}
+
+// Work out how far an interrupted commit got from what is on disk
+func (tx *Transaction) reconcile() {
+	for i := range tx.Ops {
+		op := &tx.Ops[i]
+		if _, err := os.Lstat(tx.backupPath(i)); err == nil {
+			op.Backup = tx.backupPath(i)
+		}
+
+		switch op.Kind {
+		case opWrite:
+			_, err := os.Lstat(op.Staged)
+			op.Done = os.IsNotExist(err)
+		case opDelete:
+			_, err := os.Lstat(tx.path(op.Target))
+			op.Done = op.Backup != "" || os.IsNotExist(err)
+		}
+	}
+}
+
+// Apply every change, rolling back on the first failure
+func (tx *Transaction) Commit() error {
+	tx.prepare()
+	for i := range tx.Ops {
+		if err := tx.apply(i); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				return fmt.Errorf("%v; rollback failed: %v", err, rbErr)
+			}
+			return err
+		}
+	}
+	tx.prune()
+	return nil
+}
+
+func (tx *Transaction) apply(i int) error {
+	op := &tx.Ops[i]
+	target := tx.path(op.Target)
+
+	// keep whatever is there so it can be restored
+	if _, err := os.Lstat(target); err == nil && op.Backup == "" {
+		backup := tx.backupPath(i)
+		if err := os.MkdirAll(filepath.Dir(backup), os.ModePerm); err != nil {
+			return fmt.Errorf("backing up %v: %v", op.Target, err)
+		}
+		if err := os.Rename(target, backup); err != nil {
+			return fmt.Errorf("backing up %v: %v", op.Target, err)
+		}
+		op.Backup = backup
+	}
+
+	if op.Kind == opWrite {
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return fmt.Errorf("creating folder for %v: %v", op.Target, err)
+		}
+		if err := os.Rename(op.Staged, target); err != nil {
+			return fmt.Errorf("writing %v: %v", op.Target, err)
+		}
+	}
+
+	op.Done = true
+	return nil
+}
+
+// Undo every applied change in reverse order
+func (tx *Transaction) Rollback() error {
+	var failed []string
+	for i := len(tx.Ops) - 1; i >= 0; i-- {
+		op := &tx.Ops[i]
+		target := tx.path(op.Target)
+
+		if op.Kind == opWrite && op.Done {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				failed = append(failed, op.Target)
+				continue
+			}
+		}
+		for j := len(op.Created) - 1; j >= 0; j-- {
+			os.Remove(op.Created[j])
+		}
+		if op.Backup != "" {
+			// a later write may have recreated the folder, empty again by now,
+			// and renaming over it fails on Windows
+			if info, err := os.Lstat(target); err == nil && info.IsDir() {
+				os.Remove(target)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				failed = append(failed, op.Target)
+				continue
+			}
+			if err := os.Rename(op.Backup, target); err != nil {
+				failed = append(failed, op.Target)
+				continue
+			}
+			op.Backup = ""
+		}
+		op.Done = false
+	}
+
+	if len(failed) > 0 {
+		tx.keep = true
+		return fmt.Errorf("could not restore %s, backups kept in %v", strings.Join(failed, ", "), tx.Dir)
+	}
+	log.Printf("Rolled back %d changes", len(tx.Ops))
+	return nil
+}
+
+// Remove queued folders that are now empty, deepest first
+func (tx *Transaction) prune() {
+	dirs := append([]string{}, tx.Prune...)
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+	for _, dir := range dirs {
+		dirPath := tx.path(dir)
+		entries, err := ioutil.ReadDir(dirPath)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirPath); err != nil {
+			log.Printf("Could not remove %v: %v", dir, err)
+		}
+	}
+}
+
+// Delete the staging tree and any backups
+func (tx *Transaction) Close() error {
+	if tx.keep {
+		return nil
+	}
+	err := os.RemoveAll(tx.Dir)
+	// only removed once no other transaction is using it
+	os.Remove(filepath.Dir(tx.Dir))
+	return err
+}
+
+// Remove staging folders left by applies that stopped before writing a
+// journal
+//
+// The folder of an unfinished journal is kept for recovery. Callers must
+// hold the instance lock so no running apply loses its staging tree.
+func removeStaleTransactions(kerbalDir string) (int, error) {
+	journal, err := ReadJournal(kerbalDir)
+	if err != nil {
+		return 0, err
+	}
+	keep := ""
+	if journal != nil {
+		keep = filepath.Clean(journal.Transaction.Dir)
+	}
+
+	root := filepath.Join(kerbalDir, workDir)
+	dirs, err := filepath.Glob(filepath.Join(root, "tx-*"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, dir := range dirs {
+		if filepath.Clean(dir) == keep {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	os.Remove(root)
+	return removed, nil
+}
+
+// Folders between root and dir that do not exist yet, outermost first
+func missingDirs(root, dir string) []string {
+	missing := make([]string, 0)
+	for ; dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		missing = append([]string{dir}, missing...)
+	}
+	return missing
+}
@@ -0,0 +1,186 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readTestFile(t *testing.T, p string) string {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("reading %v: %v", p, err)
+	}
+	return string(data)
+}
+
+func TestTransactionCommit(t *testing.T) {
+	kerbalDir := t.TempDir()
+	old := filepath.Join(kerbalDir, "GameData", "Old.cfg")
+	os.MkdirAll(filepath.Dir(old), os.ModePerm)
+	os.WriteFile(old, []byte("old"), 0644)
+
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Delete("GameData/Old.cfg")
+	if _, err := tx.StageFile("GameData/New/New.cfg", testEntry(t, "New.cfg", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("could not commit: %v", err)
+	}
+	tx.Close()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("deleted file still present")
+	}
+	if got := readTestFile(t, filepath.Join(kerbalDir, "GameData", "New", "New.cfg")); got != "new" {
+		t.Errorf("unexpected contents: %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(kerbalDir, workDir)); !os.IsNotExist(err) {
+		t.Error("work dir left behind")
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	kerbalDir := t.TempDir()
+	existing := filepath.Join(kerbalDir, "GameData", "Foo", "Foo.cfg")
+	os.MkdirAll(filepath.Dir(existing), os.ModePerm)
+	os.WriteFile(existing, []byte("original"), 0644)
+
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	if _, err := tx.StageFile("GameData/Foo/Foo.cfg", testEntry(t, "Foo.cfg", "replaced")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.StageFile("GameData/Bar/Bar.cfg", testEntry(t, "Bar.cfg", "bar")); err != nil {
+		t.Fatal(err)
+	}
+	// lose a staged file so the commit fails partway
+	os.Remove(tx.Ops[1].Staged)
+
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+
+	if got := readTestFile(t, existing); got != "original" {
+		t.Errorf("overwritten file not restored: %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData", "Bar")); !os.IsNotExist(err) {
+		t.Error("folder created by failed commit left behind")
+	}
+}
+
+func TestTransactionRollbackRecreatedDir(t *testing.T) {
+	kerbalDir := t.TempDir()
+	existing := filepath.Join(kerbalDir, "GameData", "Foo", "Foo.cfg")
+	os.MkdirAll(filepath.Dir(existing), os.ModePerm)
+	os.WriteFile(existing, []byte("original"), 0644)
+
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	// replace the folder, writing into it again after it was deleted
+	tx.Delete("GameData/Foo")
+	if _, err := tx.StageFile("GameData/Foo/New.cfg", testEntry(t, "New.cfg", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.StageFile("GameData/Bar/Bar.cfg", testEntry(t, "Bar.cfg", "bar")); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(tx.Ops[2].Staged)
+
+	if err := tx.Commit(); err == nil || tx.keep {
+		t.Fatalf("expected commit to fail and roll back cleanly, got %v", err)
+	}
+
+	if got := readTestFile(t, existing); got != "original" {
+		t.Errorf("deleted folder not restored: %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(kerbalDir, "GameData", "Foo", "New.cfg")); !os.IsNotExist(err) {
+		t.Error("file written into the deleted folder left behind")
+	}
+}
+
+func TestStageSharedFile(t *testing.T) {
+	kerbalDir := t.TempDir()
+	r := &Registry{}
+
+	tx, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Close()
+
+	// identical files from two queued mods pass the collision check
+	plans := []installPlan{
+		testPlan(testMod("A", "1.0"), installFile{testEntry(t, "Lib.dll", "same"), "GameData/Lib.dll"}),
+		testPlan(testMod("B", "1.0"), installFile{testEntry(t, "Lib.dll", "same"), "GameData/Lib.dll"}),
+	}
+	for _, plan := range plans {
+		files, err := r.stageInstall(context.Background(), tx, plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 || files[0].Path != "GameData/Lib.dll" {
+			t.Errorf("unexpected manifest files for %v: %v", plan.Mod.Identifier, files)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("could not commit: %v", err)
+	}
+
+	if got := readTestFile(t, filepath.Join(kerbalDir, "GameData", "Lib.dll")); got != "same" {
+		t.Errorf("unexpected contents: %v", got)
+	}
+}
+
+func TestRemoveStaleTransactions(t *testing.T) {
+	kerbalDir := t.TempDir()
+
+	// staged, but stopped before a journal was written
+	stale, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stale.StageFile("GameData/Stale.cfg", testEntry(t, "Stale.cfg", "stale")); err != nil {
+		t.Fatal(err)
+	}
+
+	// staged and journaled, so still needed for recovery
+	journaled, err := newTransaction(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journaled.StageFile("GameData/New.cfg", testEntry(t, "New.cfg", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJournal(Journal{Transaction: journaled}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clearJournal(kerbalDir) })
+
+	removed, err := removeStaleTransactions(kerbalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d staging folders, want 1", removed)
+	}
+	if _, err := os.Stat(stale.Dir); !os.IsNotExist(err) {
+		t.Error("stale staging folder left behind")
+	}
+	if _, err := os.Stat(journaled.Dir); err != nil {
+		t.Error("journaled staging folder removed")
+	}
+}
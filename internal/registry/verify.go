@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+)
+
+// VerifyError reports an archive that does not match its metadata
+type VerifyError struct {
+	Mod         string
+	Field       string
+	Expected    string
+	Actual      string
+	Quarantined string
+}
+
+func (e *VerifyError) Error() string {
+	msg := fmt.Sprintf("%v: %v mismatch, expected %v but got %v", e.Mod, e.Field, e.Expected, e.Actual)
+	if e.Quarantined != "" {
+		msg += fmt.Sprintf(", moved to %v", e.Quarantined)
+	}
+	return msg
+}
+
+// Check an archive against the size and hashes in the mod's metadata
+//
+// Fields missing from the metadata are not checked.
+func verifyArchive(mod ckan.Ckan, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sha1Sum := sha1.New()
+	sha256Sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(sha1Sum, sha256Sum), f)
+	if err != nil {
+		return fmt.Errorf("%v: reading archive: %v", mod.Name, err)
+	}
+
+	dl := mod.Download
+	if dl.Size > 0 && size != dl.Size {
+		return &VerifyError{Mod: mod.Name, Field: "size", Expected: fmt.Sprint(dl.Size), Actual: fmt.Sprint(size)}
+	}
+	if actual := hex.EncodeToString(sha256Sum.Sum(nil)); dl.Sha256 != "" && actual != dl.Sha256 {
+		return &VerifyError{Mod: mod.Name, Field: "sha256", Expected: dl.Sha256, Actual: actual}
+	}
+	if actual := hex.EncodeToString(sha1Sum.Sum(nil)); dl.Sha1 != "" && actual != dl.Sha1 {
+		return &VerifyError{Mod: mod.Name, Field: "sha1", Expected: dl.Sha1, Actual: actual}
+	}
+	return nil
+}
+
+// Verify a cached archive, quarantining it if it does not match
+func (r *Registry) verifyCached(mod ckan.Ckan, path string) error {
+	err := verifyArchive(mod, path)
+	if verr, ok := err.(*VerifyError); ok {
+		dest, qerr := r.Cache.Quarantine(path)
+		if qerr != nil {
+			return fmt.Errorf("%v; quarantine failed: %v", err, qerr)
+		}
+		verr.Quarantined = dest
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jedwards1230/go-kerbal/internal/cache"
+	"github.com/jedwards1230/go-kerbal/internal/ckan"
+)
+
+func TestVerifyCached(t *testing.T) {
+	c, err := cache.New(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Registry{Cache: c}
+
+	var mod ckan.Ckan
+	mod.Name = "Foo"
+	mod.Download.URL = "https://example.com/Foo.zip"
+	// does not match the stored bytes
+	mod.Download.Sha1 = "5bd2ef0cd7f4dfb6b6c0a71ce4e0c6c8d9e9d3a6"
+	mod.Download.Size = 7
+
+	path := cacheArchive(t, c, mod, "archive")
+
+	err = r.verifyCached(mod, path)
+	var verr *VerifyError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a VerifyError, got %v", err)
+	}
+	if verr.Field != "sha1" || verr.Expected != mod.Download.Sha1 || !strings.Contains(err.Error(), "Foo") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(verr.Quarantined); err != nil {
+		t.Errorf("archive not quarantined: %v", err)
+	}
+	if _, ok := c.Get(archiveKey(mod)); ok {
+		t.Error("mismatched archive left in cache")
+	}
+}
+
+func TestVerifyArchiveSize(t *testing.T) {
+	path := t.TempDir() + "/Foo.zip"
+	if err := os.WriteFile(path, []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mod ckan.Ckan
+	mod.Name = "Foo"
+	if err := verifyArchive(mod, path); err != nil {
+		t.Errorf("unchecked archive failed: %v", err)
+	}
+
+	mod.Download.Size = 8
+	var verr *VerifyError
+	if err := verifyArchive(mod, path); !errors.As(err, &verr) || verr.Field != "size" || verr.Actual != "7" {
+		t.Errorf("expected size mismatch, got %v", err)
+	}
+}
+
+// Put an archive for mod in the cache as a finished download would
+func cacheArchive(t *testing.T, c *cache.Cache, mod ckan.Ckan, data string) string {
+	part := c.PartPath(archiveKey(mod), archiveLabel(mod))
+	if err := os.WriteFile(part, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := c.Commit(archiveKey(mod), archiveLabel(mod), part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -1,10 +1,13 @@
 package tui
 
 import (
+	"time"
+
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/jedwards1230/go-kerbal/internal"
+	"github.com/jedwards1230/go-kerbal/internal/cache"
 	"github.com/jedwards1230/go-kerbal/internal/ckan"
 	"github.com/jedwards1230/go-kerbal/internal/config"
 	"github.com/jedwards1230/go-kerbal/internal/keymap"
@@ -25,6 +28,14 @@ type Bubble struct {
 	logs           []string
 	nav            Nav
 	ready          bool
+	instanceLock   string
+	cacheEntries   []cache.Entry
+	confirmPurge   bool
+	progress       map[string]registry.Progress
+	downloads      map[string]int64
+	progressCh     chan registry.Progress
+	applyStart     time.Time
+	tasks          *tasks
 	activeBox      int
 	lastActiveBox  int
 	width          int
@@ -53,6 +64,10 @@ func InitialModel() Bubble {
 	theme.SetTheme(cfg.AppTheme)
 	reg := registry.New()
 
+	// the registry reports apply progress here for the update loop to read
+	progressCh := make(chan registry.Progress, 64)
+	reg.Progress = progressCh
+
 	iRequested := false
 	if cfg.Settings.KerbalDir == "" {
 		iRequested = true
@@ -101,6 +116,10 @@ func InitialModel() Bubble {
 		searchInput:    false,
 		ready:          false,
 		registry:       reg,
+		progress:       make(map[string]registry.Progress),
+		downloads:      make(map[string]int64),
+		progressCh:     progressCh,
+		tasks:          newTasks(),
 		nav:            nav,
 		activeBox:      internal.ModListView,
 		keyMap:         keymap.New(),
@@ -109,7 +128,7 @@ func InitialModel() Bubble {
 
 func (b Bubble) Init() tea.Cmd {
 	var cmds []tea.Cmd
-	cmds = append(cmds, b.getAvailableModsCmd(), b.bubbles.spinner.Tick, b.TickCmd())
+	cmds = append(cmds, b.getAvailableModsCmd(), b.checkLockCmd(), b.listCacheCmd(), b.waitForProgressCmd(), b.bubbles.spinner.Tick, b.TickCmd())
 
 	return tea.Batch(cmds...)
 }
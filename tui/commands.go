@@ -1,37 +1,54 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jedwards1230/go-kerbal/internal/cache"
 	"github.com/jedwards1230/go-kerbal/internal/ckan"
 	"github.com/jedwards1230/go-kerbal/internal/common"
+	"github.com/jedwards1230/go-kerbal/internal/config"
 	"github.com/jedwards1230/go-kerbal/internal/dirfs"
 	"github.com/jedwards1230/go-kerbal/internal/registry"
 	"github.com/spf13/viper"
 )
 
 type (
-	UpdatedModMapMsg    map[string][]ckan.Ckan
-	InstalledModListMsg map[string]interface{}
-	UpdateKspDirMsg     bool
-	ErrorMsg            error
-	SearchMsg           registry.ModIndex
-	SortedMsg           map[string]interface{}
-	TickMsg             map[string]interface{}
+	UpdatedModMapMsg        map[string][]ckan.Ckan
+	InstalledModListMsg     map[string]interface{}
+	UpdateKspDirMsg         bool
+	UpdateCompatVersionsMsg bool
+	InstanceLockMsg         string
+	ApplyLockedMsg          string
+	CacheMsg                []cache.Entry
+	CacheUpdatedMsg         []cache.Entry
+	ProgressMsg             registry.Progress
+	CancelledMsg            string
+	ErrorMsg                error
+	SearchMsg               registry.ModIndex
+	SortedMsg               map[string]interface{}
+	TickMsg                 map[string]interface{}
 )
 
 // Request the mod list from the database
 func (b Bubble) getAvailableModsCmd() tea.Cmd {
 	return func() tea.Msg {
+		ctx, done := b.tasks.start()
+		defer done()
+
 		common.LogCommand("Checking available mods")
-		b.registry.DB.UpdateDB(false)
+		err := b.registry.DB.UpdateDB(ctx, false)
+		if ctx.Err() != nil {
+			common.LogWarningf("Mod list update cancelled: %v", err)
+		}
 		updatedModMap := b.registry.GetEntireModList()
-		if len(updatedModMap) == 0 {
-			b.registry.DB.UpdateDB(true)
+		if len(updatedModMap) == 0 && ctx.Err() == nil {
+			b.registry.DB.UpdateDB(ctx, true)
 			updatedModMap = b.registry.GetEntireModList()
 		}
 		return UpdatedModMapMsg(updatedModMap)
@@ -54,6 +71,7 @@ func (b Bubble) updateKspDirCmd(s string) tea.Cmd {
 			return UpdateKspDirMsg(false)
 		}
 		kerbalVer := dirfs.FindKspVersion(kerbalDir)
+
 		viper.Set("settings.kerbal_dir", kerbalDir)
 		viper.Set("settings.kerbal_ver", kerbalVer.String())
 		viper.WriteConfigAs(viper.ConfigFileUsed())
@@ -63,46 +81,149 @@ func (b Bubble) updateKspDirCmd(s string) tea.Cmd {
 	}
 }
 
+// Save extra KSP versions to treat as compatible
+func (b Bubble) updateCompatVersionsCmd(s string) tea.Cmd {
+	return func() tea.Msg {
+		versions := make([]string, 0)
+		for _, field := range strings.Split(s, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			v, err := ckan.ParseGameVersion(field)
+			if err != nil || v.IsAny() {
+				common.LogErrorf("Invalid KSP version: %s", field)
+				return UpdateCompatVersionsMsg(false)
+			}
+			versions = append(versions, v.String())
+		}
+
+		// accepted versions belong to the current instance
+		cfg := config.GetConfig()
+		config.SetCompatibleVersions(cfg.Settings.KerbalDir, versions)
+		viper.WriteConfigAs(viper.ConfigFileUsed())
+		log.Printf("Compatible versions: %v", versions)
+		return UpdateCompatVersionsMsg(true)
+	}
+}
+
 // Download selected mods
 func (b *Bubble) applyModsCmd() tea.Cmd {
 	return func() tea.Msg {
+		ctx, done := b.tasks.start()
+		defer done()
 
-		// Remove Mods
-		if b.registry.Queue.RemoveLen() > 0 {
-			common.LogCommandf("Removing %d mods", b.registry.Queue.RemoveLen())
-			err := b.registry.RemoveMods()
-			if err != nil {
-				return fmt.Errorf("error removing: %v", err)
+		if b.registry.Queue.ChoiceLen() > 0 {
+			return ErrorMsg(fmt.Errorf("%d dependencies need a choice before applying", b.registry.Queue.ChoiceLen()))
+		}
+
+		// don't download anything while another program holds the instance
+		cfg := config.GetConfig()
+		if err := registry.CheckLock(cfg.Settings.KerbalDir); err != nil {
+			if msg := lockMsg(err); msg != "" {
+				return ApplyLockedMsg(msg)
 			}
+			return ErrorMsg(fmt.Errorf("error checking instance lock: %v", err))
 		}
 
-		// Install Mods
+		// Download Mods
 		if b.registry.Queue.InstallLen() > 0 {
-			// Create tmp dir
-			f, err := os.MkdirTemp("", "tmp")
-			if err != nil {
-				return fmt.Errorf("error creating tmp dir: %v", err)
+			err := b.registry.DownloadMods(ctx)
+			if ctx.Err() != nil {
+				return CancelledMsg("Apply")
 			}
-			defer os.RemoveAll(f)
-
-			b.registry.SetTempDir(f)
-
-			common.LogCommandf("Downloading %d mods", b.registry.Queue.InstallLen())
-			err = b.registry.DownloadMods()
 			if err != nil {
-				return fmt.Errorf("error downloading: %v", err)
+				return ErrorMsg(fmt.Errorf("error downloading: %v", err))
 			}
+		}
 
-			common.LogCommandf("Installing %d mods", b.registry.Queue.InstallLen())
-			err = b.registry.InstallMods()
-			if err != nil {
-				return fmt.Errorf("error installing: %v", err)
+		// Remove and install together so a failure leaves nothing half done
+		common.LogCommandf("Removing %d and installing %d mods", b.registry.Queue.RemoveLen(), b.registry.Queue.InstallLen())
+		err := b.registry.ApplyMods(ctx)
+		if errors.Is(err, context.Canceled) {
+			return CancelledMsg("Apply")
+		}
+		if err != nil {
+			var locked *registry.LockedError
+			if errors.As(err, &locked) {
+				return ApplyLockedMsg(lockMsg(err))
 			}
+			return ErrorMsg(fmt.Errorf("error applying: %v", err))
 		}
 		return InstalledModListMsg{}
 	}
 }
 
+// List archives in the download cache
+func (b Bubble) listCacheCmd() tea.Cmd {
+	return func() tea.Msg {
+		entries, err := b.registry.Cache.List()
+		if err != nil {
+			return ErrorMsg(fmt.Errorf("error reading cache: %v", err))
+		}
+		return CacheMsg(entries)
+	}
+}
+
+// Delete every archive in the download cache
+func (b Bubble) purgeCacheCmd() tea.Cmd {
+	return func() tea.Msg {
+		common.LogCommand("Purging download cache")
+		if err := b.registry.Cache.Purge(); err != nil {
+			return ErrorMsg(fmt.Errorf("error purging cache: %v", err))
+		}
+		common.LogSuccess("Download cache purged")
+		return CacheUpdatedMsg{}
+	}
+}
+
+// Download every installed mod into the cache
+func (b Bubble) fillCacheCmd() tea.Cmd {
+	return func() tea.Msg {
+		ctx, done := b.tasks.start()
+		defer done()
+
+		mods, err := b.registry.PrefillCache(ctx, nil)
+		if ctx.Err() != nil {
+			return CancelledMsg("Cache fill")
+		}
+		if err != nil {
+			return ErrorMsg(fmt.Errorf("error filling cache: %v", err))
+		}
+		common.LogSuccessf("Cached %d installed mods", len(mods))
+
+		entries, err := b.registry.Cache.List()
+		if err != nil {
+			return ErrorMsg(fmt.Errorf("error reading cache: %v", err))
+		}
+		return CacheUpdatedMsg(entries)
+	}
+}
+
+// Wait for the next progress report from the registry
+func (b Bubble) waitForProgressCmd() tea.Cmd {
+	return func() tea.Msg {
+		return ProgressMsg(<-b.progressCh)
+	}
+}
+
+// Check if another program is working on the KSP instance
+func (b Bubble) checkLockCmd() tea.Cmd {
+	return func() tea.Msg {
+		cfg := config.GetConfig()
+		return lockMsg(registry.CheckLock(cfg.Settings.KerbalDir))
+	}
+}
+
+// Describe who holds the instance lock, empty if nobody does
+func lockMsg(err error) InstanceLockMsg {
+	var locked *registry.LockedError
+	if errors.As(err, &locked) {
+		return InstanceLockMsg(fmt.Sprintf("Instance is locked by %v (pid %d)", locked.Owner, locked.PID))
+	}
+	return InstanceLockMsg("")
+}
+
 // Download selected mods
 func (b Bubble) searchCmd(s string) tea.Cmd {
 	return func() tea.Msg {
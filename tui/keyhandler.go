@@ -2,6 +2,8 @@ package tui
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -10,6 +12,7 @@ import (
 	"github.com/jedwards1230/go-kerbal/internal/common"
 	"github.com/jedwards1230/go-kerbal/internal/config"
 	"github.com/jedwards1230/go-kerbal/internal/queue"
+	"github.com/jedwards1230/go-kerbal/internal/registry"
 	"github.com/spf13/viper"
 )
 
@@ -19,8 +22,20 @@ func (b *Bubble) handleKeys(msg tea.KeyMsg) tea.Cmd {
 
 	if b.outOfBounds() {
 		if key.Matches(msg, b.keyMap.Quit) {
-			log.Print("Quitting")
-			return tea.Quit
+			return b.quitOrCancel()
+		}
+		return tea.Batch(cmds...)
+	}
+
+	// keys are typed into the input instead of triggering shortcuts
+	if b.inputRequested && (b.activeBox == internal.EnterKspDirView || b.activeBox == internal.CompatVersionsView) {
+		switch {
+		case key.Matches(msg, b.keyMap.Quit):
+			return b.quitOrCancel()
+		case key.Matches(msg, b.keyMap.Enter):
+			return b.handleEnterKey()
+		case key.Matches(msg, b.keyMap.Esc):
+			return b.resetView()
 		}
 		return tea.Batch(cmds...)
 	}
@@ -28,8 +43,13 @@ func (b *Bubble) handleKeys(msg tea.KeyMsg) tea.Cmd {
 	switch {
 	// Quit
 	case key.Matches(msg, b.keyMap.Quit):
-		log.Print("Quitting")
-		return tea.Quit
+		return b.quitOrCancel()
+
+	// Cancel running task
+	case key.Matches(msg, b.keyMap.Cancel):
+		if b.tasks.cancelAll() {
+			common.LogWarning("Cancelling...")
+		}
 
 	// Down
 	case key.Matches(msg, b.keyMap.Down):
@@ -80,7 +100,7 @@ func (b *Bubble) handleKeys(msg tea.KeyMsg) tea.Cmd {
 
 	// Refresh list
 	case key.Matches(msg, b.keyMap.RefreshList):
-		if b.activeBox != internal.EnterKspDirView && b.activeBox != internal.SearchView {
+		if b.activeBox != internal.EnterKspDirView && b.activeBox != internal.CompatVersionsView && b.activeBox != internal.SearchView {
 			b.ready = false
 			cmds = append(cmds, b.getAvailableModsCmd(), b.bubbles.spinner.Tick)
 		}
@@ -111,13 +131,26 @@ func (b *Bubble) handleKeys(msg tea.KeyMsg) tea.Cmd {
 	return tea.Batch(cmds...)
 }
 
+// Cancel running tasks so they stop cleanly, quitting only if there are none
+func (b *Bubble) quitOrCancel() tea.Cmd {
+	if b.tasks.cancelAll() {
+		common.LogWarning("Cancelling... press ctrl+c again to quit")
+		return nil
+	}
+	log.Print("Quitting")
+	return tea.Quit
+}
+
 func (b *Bubble) toggleSelectedItem() {
 	if len(b.registry.ModMapIndex) > 0 {
 		mod := b.nav.activeMod
 
 		// toggle mod in queue
 		if b.registry.Queue.CheckQueue(mod.Identifier) {
-			b.registry.Queue.RemoveFromQueue(mod.Identifier)
+			err := b.registry.RemoveFromQueue(mod.Identifier)
+			if err != nil {
+				common.LogErrorf("removing from queue: %v", err)
+			}
 		} else {
 			err := b.registry.AddToQueue(mod)
 			if err != nil {
@@ -129,6 +162,7 @@ func (b *Bubble) toggleSelectedItem() {
 
 func (b *Bubble) resetView() tea.Cmd {
 	b.nav.boolCursor = false
+	b.confirmPurge = false
 	b.nav.listCursor = 0
 	b.nav.listCursorHide = true
 	b.registry.Queue = queue.New()
@@ -151,6 +185,21 @@ func (b *Bubble) handleEnterKey() tea.Cmd {
 		}
 	case internal.EnterKspDirView:
 		cmds = append(cmds, b.updateKspDirCmd(b.bubbles.textInput.Value()))
+	case internal.CompatVersionsView:
+		cmds = append(cmds, b.updateCompatVersionsCmd(b.bubbles.textInput.Value()))
+	case internal.CacheView:
+		// ask before deleting every archive
+		if !b.confirmPurge {
+			b.confirmPurge = true
+			b.nav.boolCursor = false
+		} else {
+			if b.nav.boolCursor {
+				b.ready = false
+				cmds = append(cmds, b.purgeCacheCmd(), b.bubbles.spinner.Tick)
+			}
+			b.confirmPurge = false
+			b.nav.boolCursor = false
+		}
 	case internal.SettingsView:
 		cmds = append(cmds, b.handleSettingsInput())
 	case internal.QueueView:
@@ -158,6 +207,9 @@ func (b *Bubble) handleEnterKey() tea.Cmd {
 			if b.nav.boolCursor {
 				// apply mods in queue
 				b.ready = false
+				b.progress = make(map[string]registry.Progress)
+				b.downloads = make(map[string]int64)
+				b.applyStart = time.Now()
 				cmds = append(cmds, b.applyModsCmd(), b.bubbles.spinner.Tick)
 			} else {
 				// cancel
@@ -205,6 +257,19 @@ func (b *Bubble) prepareKspDirView() tea.Cmd {
 	return cmd
 }
 
+// Handle screen to input extra compatible KSP versions
+func (b *Bubble) prepareCompatVersionsView() tea.Cmd {
+	cfg := config.GetConfig()
+	b.switchActiveView(internal.CompatVersionsView)
+	b.inputRequested = true
+	b.bubbles.textInput.Reset()
+	b.bubbles.textInput.Placeholder = "1.11, 1.10..."
+	if len(cfg.Settings.CompatibleVersions()) > 0 {
+		b.bubbles.textInput.SetValue(strings.Join(cfg.Settings.CompatibleVersions(), ", "))
+	}
+	return textinput.Blink
+}
+
 // Handle search page
 func (b *Bubble) prepareSearchView() tea.Cmd {
 	var cmd tea.Cmd
@@ -267,6 +332,17 @@ func (b *Bubble) handleSettingsInput() tea.Cmd {
 		cmds = append(cmds, b.getAvailableModsCmd(), b.bubbles.spinner.Tick)
 	case internal.MenuKspDir:
 		cmds = append(cmds, b.prepareKspDirView())
+	case internal.MenuCompatVersions:
+		cmds = append(cmds, b.prepareCompatVersionsView())
+	case internal.MenuCache:
+		b.confirmPurge = false
+		b.switchActiveView(internal.CacheView)
+		cmds = append(cmds, b.listCacheCmd())
+	case internal.MenuCacheFill:
+		b.ready = false
+		b.progress = make(map[string]registry.Progress)
+		b.downloads = make(map[string]int64)
+		cmds = append(cmds, b.fillCacheCmd(), b.bubbles.spinner.Tick)
 	}
 	return tea.Batch(cmds...)
 }
@@ -9,9 +9,11 @@ import (
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/jedwards1230/go-kerbal/internal"
+	"github.com/jedwards1230/go-kerbal/internal/cache"
 	"github.com/jedwards1230/go-kerbal/internal/ckan"
 	"github.com/jedwards1230/go-kerbal/internal/common"
 	"github.com/jedwards1230/go-kerbal/internal/config"
+	"github.com/jedwards1230/go-kerbal/internal/registry"
 	"github.com/jedwards1230/go-kerbal/internal/style"
 	"github.com/jedwards1230/go-kerbal/internal/theme"
 )
@@ -92,23 +94,28 @@ func (b Bubble) modInfoView() string {
 
 		identifier := drawKV("Identifier", mod.Identifier)
 		license := drawKV("License", mod.License)
+		source := drawKV("Source Repo", mod.SourceRepo)
 		author := drawKV("Author", mod.Author)
-		version := drawKV("Mod Version", mod.Versions.Mod)
-		versionKsp := drawKV("KSP Versions", fmt.Sprintf("%v - %v", mod.Versions.KspMin, mod.Versions.KspMax))
+		version := drawKV("Mod Version", mod.Versions.Mod.String())
+		versionKsp := drawKV("KSP Versions", mod.Versions.Ksp.String())
 		installed := drawKV("Installed", "Not Installed")
 		if mod.Installed() {
 			installed = drawKVColor("Installed", "Installed", theme.AppTheme.InstalledColor)
 		}
-		installDir := drawKV("Install dir", mod.Install.InstallTo)
+		installDir := drawKV("Install dir", strings.Join(mod.InstallDirs(), ", "))
 		download := trunc(mod.Download.URL, (b.bubbles.secondaryViewport.Width*2/3)-3)
 		download = drawKV("Download", download)
 		dependencies := drawKVColor("Dependencies", "None", theme.AppTheme.Green)
 		if len(mod.ModDepends) > 0 {
-			dependencies = drawKVColor("Dependencies", strings.Join(mod.ModDepends, ", "), theme.AppTheme.Orange)
+			dependencies = drawKVColor("Dependencies", ckan.JoinRelationships(mod.ModDepends), theme.AppTheme.Orange)
+		}
+		provides := drawKV("Provides", "None")
+		if len(mod.Provides) > 0 {
+			provides = drawKV("Provides", strings.Join(mod.Provides, ", "))
 		}
 		conflicts := drawKVColor("Conflicts", "None", theme.AppTheme.Green)
 		if len(mod.ModConflicts) > 0 {
-			conflicts = drawKVColor("Conflicts", strings.Join(mod.ModConflicts, ", "), theme.AppTheme.Red)
+			conflicts = drawKVColor("Conflicts", ckan.JoinRelationships(mod.ModConflicts), theme.AppTheme.Red)
 		}
 
 		return connectVert(
@@ -117,6 +124,7 @@ func (b Bubble) modInfoView() string {
 			author,
 			identifier,
 			license,
+			source,
 			"\n",
 			version,
 			versionKsp,
@@ -126,6 +134,7 @@ func (b Bubble) modInfoView() string {
 			download,
 			"\n",
 			dependencies,
+			provides,
 			conflicts,
 		)
 	}
@@ -207,6 +216,9 @@ func (b Bubble) queueView() string {
 	installStyle := entryStyle.Copy().
 		Foreground(theme.AppTheme.Green)
 
+	failedStyle := entryStyle.Copy().
+		Foreground(theme.AppTheme.Red)
+
 	if b.registry.Queue.Len() > 0 {
 		selectedStyle := entryStyle.Copy().
 			Foreground(theme.AppTheme.UnselectedListItemColor).
@@ -219,13 +231,29 @@ func (b Bubble) queueView() string {
 			)
 		}
 
+		// add the mod's progress while the queue is applied
+		withProgress := func(mod ckan.Ckan) string {
+			p, ok := b.progress[mod.Identifier]
+			if !ok {
+				return mod.Name
+			}
+			nameWidth := b.bubbles.primaryPaginator.Width - 50
+			if nameWidth < 10 {
+				nameWidth = 10
+			}
+			return fmt.Sprintf("%-*s %s", nameWidth, trunc(mod.Name, nameWidth), progressBar(p, 20))
+		}
+
 		applyLineStyle := func(i int, mod ckan.Ckan) string {
+			name := withProgress(mod)
 			if b.bubbles.primaryPaginator.GetCursorIndex() == i && !b.nav.listCursorHide {
-				return selectedStyle.Render(trimName(mod.Name))
+				return selectedStyle.Render(trimName(name))
+			} else if b.progress[mod.Identifier].Phase == registry.PhaseFailed {
+				return failedStyle.Render(trimName(name))
 			} else if mod.Installed() {
-				return installStyle.Render(trimName(mod.Name))
+				return installStyle.Render(trimName(name))
 			} else {
-				return entryStyle.Render(trimName(mod.Name))
+				return entryStyle.Render(trimName(name))
 			}
 		}
 
@@ -240,14 +268,25 @@ func (b Bubble) queueView() string {
 				return entryStyle.Render(trimName(mod.Name))
 			} */
 
+			name := withProgress(mod)
 			if b.bubbles.primaryPaginator.GetCursorIndex() == i && !b.nav.listCursorHide {
-				return selectedStyle.Render(trimName(mod.Name))
+				return selectedStyle.Render(trimName(name))
+			} else if b.progress[mod.Identifier].Phase == registry.PhaseFailed {
+				return failedStyle.Render(trimName(name))
 			} else {
-				return entryStyle.Render(trimName(mod.Name))
+				return entryStyle.Render(trimName(name))
+			}
+		}
+
+		choiceLineStyle := func(i int, mod ckan.Ckan) string {
+			name := fmt.Sprintf("%s (for %s)", mod.Name, strings.Join(b.registry.Queue.ChoiceRequesters(mod.Identifier), ", "))
+			if b.bubbles.primaryPaginator.GetCursorIndex() == i && !b.nav.listCursorHide {
+				return selectedStyle.Render(trimName(name))
 			}
+			return entryStyle.Render(trimName(name))
 		}
 
-		var removeList, installList, dependencyList []string
+		var removeList, installList, dependencyList, choiceList []string
 		start, end := b.bubbles.primaryPaginator.GetSliceBounds()
 		for i, entry := range b.registry.ModMapIndex[start:end] {
 			mod := b.registry.Queue.List[entry.SearchBy][entry.Key]
@@ -260,6 +299,10 @@ func (b Bubble) queueView() string {
 
 			case "dependency":
 				dependencyList = append(dependencyList, applyLineStyle(i, mod))
+
+			case "choice":
+				mod, _ = b.registry.Queue.GetChoiceOption(entry.Key)
+				choiceList = append(choiceList, choiceLineStyle(i, mod))
 			}
 		}
 
@@ -294,6 +337,16 @@ func (b Bubble) queueView() string {
 			)
 		}
 
+		// Display alternatives waiting on the user
+		if b.registry.Queue.ChoiceLen() > 0 {
+			choiceContent := connectVert(choiceList...)
+			content = connectVert(
+				content,
+				titleStyle.Foreground(theme.AppTheme.Orange).Render("Choose One"),
+				choiceContent,
+			)
+		}
+
 		if content != "" {
 			return connectVert(
 				pageStyle(content),
@@ -327,7 +380,19 @@ func (b Bubble) settingsView() string {
 	compat := b.drawKV("Hide Incompatible", fmt.Sprintf("%v", cfg.Settings.HideIncompatibleMods), false)
 
 	kspDir := trunc(cfg.Settings.KerbalDir, (b.bubbles.secondaryViewport.Width*2/3)-3)
-	metaRepo := trunc(cfg.Settings.MetaRepo, (b.bubbles.secondaryViewport.Width*2/3)-3)
+	metaRepo := cfg.Settings.MetaRepo
+	if len(cfg.Settings.MetaRepos) > 0 {
+		var repoNames []string
+		repos, err := cfg.Settings.Repos()
+		for _, repo := range repos {
+			repoNames = append(repoNames, fmt.Sprintf("%s (%d)", repo.Name, repo.Priority))
+		}
+		metaRepo = strings.Join(repoNames, ", ")
+		if err != nil {
+			metaRepo = err.Error()
+		}
+	}
+	metaRepo = trunc(metaRepo, (b.bubbles.secondaryViewport.Width*2/3)-3)
 	hash := trunc(cfg.Settings.LastRepoHash, (b.bubbles.secondaryViewport.Width*2/3)-3)
 
 	if b.nav.menuCursor == internal.MenuKspDir {
@@ -337,9 +402,28 @@ func (b Bubble) settingsView() string {
 	}
 
 	configLines = append(configLines, b.drawKV("Kerbal Version", cfg.Settings.KerbalVer, false))
+
+	compatVersions := "None"
+	if len(cfg.Settings.CompatibleVersions()) > 0 {
+		compatVersions = strings.Join(cfg.Settings.CompatibleVersions(), ", ")
+	}
+	compatVersions = trunc(compatVersions, (b.bubbles.secondaryViewport.Width*2/3)-3)
+	configLines = append(configLines, b.drawKV("Also Compatible", compatVersions, b.nav.menuCursor == internal.MenuCompatVersions))
+	var cacheSize int64
+	for _, e := range b.cacheEntries {
+		cacheSize += e.Size
+	}
+	cacheSummary := fmt.Sprintf("%d archives, %v", len(b.cacheEntries), cache.FormatSize(cacheSize))
+	configLines = append(configLines, b.drawKV("Download Cache", cacheSummary, b.nav.menuCursor == internal.MenuCache))
+	configLines = append(configLines, b.drawKV("Pre-fill Cache", "Installed mods", b.nav.menuCursor == internal.MenuCacheFill))
 	configLines = append(configLines, b.drawKV("Logging", fmt.Sprintf("%v", cfg.Settings.EnableLogging), false))
 	configLines = append(configLines, b.drawKV("Mousewheel", fmt.Sprintf("%v", cfg.Settings.EnableMouseWheel), false))
 	configLines = append(configLines, b.drawKV("Metadata Repo", metaRepo, false))
+	if cfg.Settings.MetaPath != "" {
+		metaPath := trunc(cfg.Settings.MetaPath, (b.bubbles.secondaryViewport.Width*2/3)-3)
+		configLines = append(configLines, b.drawKV("Metadata Snapshot", metaPath, false))
+	}
+	configLines = append(configLines, b.drawKV("Offline", fmt.Sprintf("%v", cfg.Settings.Offline), false))
 	configLines = append(configLines, b.drawKV("Last Repo Hash", hash, false))
 	configLines = append(configLines, b.drawKV("Theme", cfg.AppTheme, false))
 
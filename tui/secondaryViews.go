@@ -2,9 +2,11 @@ package tui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/jedwards1230/go-kerbal/internal"
+	"github.com/jedwards1230/go-kerbal/internal/cache"
 	"github.com/jedwards1230/go-kerbal/internal/theme"
 )
 
@@ -16,12 +18,24 @@ func (b Bubble) homeView() string {
 	var content string
 	switch b.activeBox {
 	case internal.QueueView:
+		lockLine := ""
+		if b.instanceLock != "" {
+			lockLine = b.instanceLock + " \n\n"
+		}
+		progressLine := ""
+		if summary := b.applySummary(); summary != "" {
+			progressLine = summary + " \n\n"
+		}
 		content = "" +
 			fmt.Sprintf("Installing %d mods \n", b.registry.Queue.InstallLen()) +
 			fmt.Sprintf("Removing %d mods \n", b.registry.Queue.RemoveLen()) +
+			fmt.Sprintf("Choosing %d dependencies \n", b.registry.Queue.ChoiceLen()) +
 			"\n" +
+			lockLine +
+			progressLine +
 			"Press up/down to scroll the list \n" +
 			"Press enter to remove the selected mod \n" +
+			"Press enter on an option under Choose One to pick it \n" +
 			"\n" +
 			"Press tab to get back to the confirmation window \n"
 		content = styleWidth(b.bubbles.secondaryViewport.Width).
@@ -76,6 +90,77 @@ func (b Bubble) inputKspView() string {
 		Render(content)
 }
 
+func (b Bubble) inputCompatVersionsView() string {
+	question := styleWidth(b.width).
+		Align(lipgloss.Left).
+		Padding(1).
+		Render(fmt.Sprintf("Enter extra KSP versions to treat as compatible with %s, separated by commas:", b.appConfig.Settings.KerbalVer))
+
+	inText := styleWidth(b.width).
+		Align(lipgloss.Left).
+		Padding(1).
+		Render(b.bubbles.textInput.View() + "\n\nPress Enter to save or Esc to close")
+
+	content := connectVert(
+		question,
+		inText,
+	)
+
+	return styleWidth(b.bubbles.splashPaginator.Width).
+		Height(b.bubbles.splashPaginator.Height + 1).
+		Render(content)
+}
+
+func (b Bubble) cacheView() string {
+	c := b.registry.Cache
+
+	var size int64
+	lines := make([]string, 0, len(b.cacheEntries))
+	for _, e := range b.cacheEntries {
+		size += e.Size
+		lines = append(lines, fmt.Sprintf("%-60s %10s  %s", trunc(e.Name, 60), cache.FormatSize(e.Size), e.ModTime.Format("2006-01-02 15:04")))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No archives cached")
+	}
+
+	header := styleWidth(b.width).
+		Align(lipgloss.Left).
+		Padding(1).
+		Render(fmt.Sprintf("%d archives using %v of %v in %v", len(b.cacheEntries), cache.FormatSize(size), cache.FormatSize(c.MaxSize), c.Dir))
+
+	list := styleWidth(b.width).
+		Align(lipgloss.Left).
+		Padding(0, 1).
+		Render(strings.Join(lines, "\n"))
+
+	footer := styleWidth(b.width).
+		Align(lipgloss.Left).
+		Padding(1).
+		Render("Press Enter to purge or Esc to close")
+	if b.confirmPurge {
+		footer = connectVert(
+			styleWidth(b.width).
+				Bold(true).
+				Padding(1, 1, 0).
+				Render(fmt.Sprintf("Delete all %d cached archives?", len(b.cacheEntries))),
+			styleWidth(b.width).
+				Padding(0, 1).
+				Render(b.boolOptions(true)),
+		)
+	}
+
+	content := connectVert(
+		header,
+		list,
+		footer,
+	)
+
+	return styleWidth(b.bubbles.splashPaginator.Width).
+		Height(b.bubbles.splashPaginator.Height + 1).
+		Render(content)
+}
+
 // todo: make this easier to use between different views with different inputs
 func (b Bubble) helpView() string {
 	leftColumn := []string{
@@ -92,6 +177,7 @@ func (b Bubble) helpView() string {
 		b.drawHelpKV("3", "Apply"),
 		b.drawHelpKV("0", "Settings"),
 		b.drawHelpKV("shift+o", "Logs"),
+		b.drawHelpKV("ctrl+x", "Cancel"),
 	}
 
 	var content string
@@ -126,6 +212,30 @@ func (b Bubble) getBoolOptionsView() string {
 		Align(lipgloss.Center).
 		Padding(1, 2, 0)
 
+	options := styleWidth(b.bubbles.commandViewport.Width - 4).
+		Align(lipgloss.Center).
+		Render(b.boolOptions(b.nav.listCursorHide))
+
+	title := "Apply?"
+	if b.registry.Queue.ChoiceLen() > 0 {
+		title = "Choose dependencies first"
+	}
+	if b.instanceLock != "" {
+		title = b.instanceLock
+	}
+
+	content := connectVert(
+		titleStyle.Render(title),
+		options,
+	)
+
+	return styleWidth(b.bubbles.commandViewport.Width).
+		Height(b.bubbles.commandViewport.Height).
+		Render(content)
+}
+
+// Cancel and Confirm buttons, highlighting the one boolCursor is on
+func (b Bubble) boolOptions(active bool) string {
 	optionStyle := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
 		Align(lipgloss.Center).
@@ -137,7 +247,7 @@ func (b Bubble) getBoolOptionsView() string {
 	cancel := optionStyle.Render("Cancel")
 	confirm := optionStyle.Render("Confirm")
 
-	if b.nav.listCursorHide {
+	if active {
 		if b.nav.boolCursor {
 			confirm = optionStyle.Copy().
 				Border(lipgloss.RoundedBorder()).
@@ -155,17 +265,5 @@ func (b Bubble) getBoolOptionsView() string {
 		}
 	}
 
-	options := connectHorz(cancel, "  ", confirm)
-	options = styleWidth(b.bubbles.commandViewport.Width - 4).
-		Align(lipgloss.Center).
-		Render(options)
-
-	content := connectVert(
-		titleStyle.Render("Apply?"),
-		options,
-	)
-
-	return styleWidth(b.bubbles.commandViewport.Width).
-		Height(b.bubbles.commandViewport.Height).
-		Render(content)
+	return connectHorz(cancel, "  ", confirm)
 }
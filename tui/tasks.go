@@ -0,0 +1,48 @@
+package tui
+
+import (
+	"context"
+	"sync"
+)
+
+// Long-running commands the user can cancel
+//
+// Shared by every copy of the Bubble so commands started from any update
+// can be found and cancelled later.
+type tasks struct {
+	mu      sync.Mutex
+	next    int
+	cancels map[int]context.CancelFunc
+}
+
+func newTasks() *tasks {
+	return &tasks{cancels: make(map[int]context.CancelFunc)}
+}
+
+// Register a task, returning its context and a function to call when it ends
+func (t *tasks) start() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t.mu.Lock()
+	id := t.next
+	t.next++
+	t.cancels[id] = cancel
+	t.mu.Unlock()
+
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.cancels, id)
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+// Cancel every running task, returning false if there were none
+func (t *tasks) cancelAll() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, cancel := range t.cancels {
+		cancel()
+	}
+	return len(t.cancels) > 0
+}
@@ -41,6 +41,7 @@ func (b Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case InstalledModListMsg:
 		b.ready = true
+		b.instanceLock = ""
 		//cmds = append(cmds, b.getAvailableModsCmd())
 
 	case UpdateKspDirMsg:
@@ -51,12 +52,27 @@ func (b Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			b.bubbles.textInput.Reset()
 			b.bubbles.textInput.SetValue(fmt.Sprintf("Success!: %v", cfg.Settings.KerbalDir))
 			b.inputRequested = false
+			// reload so compatibility and installed mods follow the new instance
+			cmds = append(cmds, b.getAvailableModsCmd(), b.checkLockCmd())
 		} else {
 			common.LogErrorf("Error updating ksp dir: %v", msg)
 			b.bubbles.textInput.Reset()
 			b.bubbles.textInput.Placeholder = "Try again..."
 		}
 
+	case UpdateCompatVersionsMsg:
+		if msg {
+			common.LogSuccess("Compatible versions updated")
+			b.bubbles.textInput.Reset()
+			b.inputRequested = false
+			b.switchActiveView(internal.SettingsView)
+			b.ready = false
+			cmds = append(cmds, b.sortModMapCmd(), b.bubbles.spinner.Tick)
+		} else {
+			b.bubbles.textInput.Reset()
+			b.bubbles.textInput.Placeholder = "Try again, e.g. 1.11, 1.10"
+		}
+
 	case SearchMsg:
 		if len(msg) >= 0 {
 			b.nav.listCursorHide = true
@@ -65,6 +81,33 @@ func (b Bubble) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			common.LogError("Error searching")
 		}
 
+	case InstanceLockMsg:
+		b.instanceLock = string(msg)
+		if msg != "" {
+			common.LogErrorf("%v", msg)
+		}
+
+	case ApplyLockedMsg:
+		b.ready = true
+		b.instanceLock = string(msg)
+		common.LogErrorf("%v", msg)
+
+	case ProgressMsg:
+		b.trackDownload(registry.Progress(msg))
+		b.progress[msg.Identifier] = registry.Progress(msg)
+		cmds = append(cmds, b.waitForProgressCmd())
+
+	case CancelledMsg:
+		b.ready = true
+		common.LogWarning(b.cancelReport(string(msg)))
+
+	case CacheMsg:
+		b.cacheEntries = msg
+
+	case CacheUpdatedMsg:
+		b.ready = true
+		b.cacheEntries = msg
+
 	case ErrorMsg:
 		b.ready = true
 		common.LogErrorf("ErrorMsg: %v", msg)
@@ -144,6 +187,12 @@ func (b *Bubble) updateActiveView(msg tea.Msg) tea.Cmd {
 	case internal.EnterKspDirView:
 		b.bubbles.splashPaginator.SetTotalPages(1)
 		b.bubbles.splashPaginator.SetContent(b.inputKspView())
+	case internal.CompatVersionsView:
+		b.bubbles.splashPaginator.SetTotalPages(1)
+		b.bubbles.splashPaginator.SetContent(b.inputCompatVersionsView())
+	case internal.CacheView:
+		b.bubbles.splashPaginator.SetTotalPages(1)
+		b.bubbles.splashPaginator.SetContent(b.cacheView())
 	case internal.SettingsView:
 		b.bubbles.primaryPaginator.SetContent(b.modListView())
 		b.bubbles.secondaryViewport.SetContent(b.settingsView())
@@ -227,6 +276,10 @@ func (b *Bubble) scrollView(dir string) {
 		}
 	case "left":
 		switch b.activeBox {
+		case internal.CacheView:
+			if b.confirmPurge {
+				b.nav.boolCursor = !b.nav.boolCursor
+			}
 		case internal.QueueView:
 			if b.nav.listCursorHide {
 				b.nav.boolCursor = !b.nav.boolCursor
@@ -245,6 +298,10 @@ func (b *Bubble) scrollView(dir string) {
 		}
 	case "right":
 		switch b.activeBox {
+		case internal.CacheView:
+			if b.confirmPurge {
+				b.nav.boolCursor = !b.nav.boolCursor
+			}
 		case internal.QueueView:
 			if b.nav.listCursorHide {
 				b.nav.boolCursor = !b.nav.boolCursor
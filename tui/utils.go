@@ -2,11 +2,17 @@ package tui
 
 import (
 	"bufio"
+	"fmt"
 	"log"
 	"os"
+	"path"
+	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/jedwards1230/go-kerbal/internal"
+	"github.com/jedwards1230/go-kerbal/internal/cache"
+	"github.com/jedwards1230/go-kerbal/internal/registry"
 )
 
 func trimLastChar(s string) string {
@@ -17,6 +23,98 @@ func trimLastChar(s string) string {
 	return s[:len(s)-size]
 }
 
+// Draw a mod's progress as a bar followed by its phase
+func progressBar(p registry.Progress, width int) string {
+	fraction := 0.0
+	switch {
+	case p.Phase == registry.PhaseDone || p.Phase == registry.PhaseCached:
+		fraction = 1
+	case p.Total > 0:
+		fraction = float64(p.Done) / float64(p.Total)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	filled := int(fraction * float64(width))
+	bar := "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+	line := fmt.Sprintf("%s %3d%% %s", bar, int(fraction*100), p.Phase)
+	if p.Phase == registry.PhaseExtracting && p.File != "" {
+		line += " " + path.Base(p.File)
+	}
+	return line
+}
+
+// Remember the archive size of each mod downloaded during the apply
+//
+// Progress only holds a mod's latest phase, so finished downloads would
+// otherwise drop out of the summary.
+func (b *Bubble) trackDownload(p registry.Progress) {
+	prev := b.progress[p.Identifier].Phase
+	switch {
+	case (p.Phase == registry.PhaseQueued || p.Phase == registry.PhaseDownloading) && p.Total > 0:
+		b.downloads[p.Identifier] = p.Total
+	case prev == registry.PhaseQueued && p.Phase == registry.PhaseCached:
+		// already cached, nothing to download
+		delete(b.downloads, p.Identifier)
+	case (prev == registry.PhaseQueued || prev == registry.PhaseDownloading) && p.Phase == registry.PhaseFailed:
+		delete(b.downloads, p.Identifier)
+	}
+}
+
+// Overall download progress and time left for the running apply
+//
+// Mods still waiting for a download slot count towards what is left, and
+// finished downloads stay counted at their full size.
+func (b Bubble) applySummary() string {
+	var done, total int64
+	var failed []string
+	for _, p := range b.progress {
+		if p.Phase == registry.PhaseFailed {
+			failed = append(failed, fmt.Sprintf("Failed: %v: %v", p.Name, p.Err))
+		}
+	}
+	for id, size := range b.downloads {
+		total += size
+		switch p := b.progress[id]; p.Phase {
+		case registry.PhaseQueued:
+		case registry.PhaseDownloading:
+			done += p.Done
+		default:
+			done += size
+		}
+	}
+
+	var lines []string
+	if total > 0 {
+		line := fmt.Sprintf("Downloaded %v of %v", cache.FormatSize(done), cache.FormatSize(total))
+		if elapsed := time.Since(b.applyStart); done > 0 && done < total && elapsed > 0 {
+			rate := float64(done) / elapsed.Seconds()
+			eta := time.Duration(float64(total-done) / rate * float64(time.Second))
+			line += fmt.Sprintf(", about %v left", eta.Round(time.Second))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, failed...)
+	return strings.Join(lines, " \n")
+}
+
+// Describe what a cancelled task got done before it stopped
+func (b Bubble) cancelReport(task string) string {
+	cached := 0
+	for _, p := range b.progress {
+		if p.Phase == registry.PhaseCached || p.Phase == registry.PhaseDone {
+			cached++
+		}
+	}
+	switch task {
+	case "Apply":
+		return fmt.Sprintf("Apply cancelled: %d of %d mods downloaded, nothing installed or removed", cached, len(b.progress))
+	default:
+		return fmt.Sprintf("%s cancelled: %d of %d mods cached", task, cached, len(b.progress))
+	}
+}
+
 func (b *Bubble) checkLogs() []string {
 	file, err := os.Open(internal.LogPath)
 	if err != nil {
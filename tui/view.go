@@ -38,6 +38,16 @@ func (b Bubble) View() string {
 			b.styleTitle("Enter Kerbal Space Program Directory"),
 			splashStyle(b.bubbles.splashPaginator.GetContent()),
 		)
+	case internal.CompatVersionsView:
+		body = connectVert(
+			b.styleTitle("Compatible KSP Versions"),
+			splashStyle(b.bubbles.splashPaginator.GetContent()),
+		)
+	case internal.CacheView:
+		body = connectVert(
+			b.styleTitle("Download Cache"),
+			splashStyle(b.bubbles.splashPaginator.GetContent()),
+		)
 	default:
 		var primaryBox string
 		var secondaryBox string
@@ -114,7 +124,7 @@ func (b Bubble) View() string {
 
 func (b Bubble) styleTitle(s string) string {
 	switch b.activeBox {
-	case internal.EnterKspDirView, internal.LogView:
+	case internal.EnterKspDirView, internal.CompatVersionsView, internal.CacheView, internal.LogView:
 		return style.PrimaryTitle.
 			Width(b.bubbles.splashPaginator.Width + 2).
 			Render(s)